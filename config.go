@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfigFile sets the settings of the YAML or JSON config file as
+// PLUGIN_ environment variables, the way Drone passes the settings of a step.
+// Environment variables already set take precedence over the file.
+func loadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+
+	// JSON is valid YAML
+	var settings map[string]interface{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("could not parse config file: %w", err)
+	}
+
+	for key, value := range settings {
+		if value == nil {
+			continue
+		}
+		name := "PLUGIN_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if _, ok := os.LookupEnv(name); ok {
+			continue
+		}
+
+		encoded, err := encodeSetting(value)
+		if err != nil {
+			return fmt.Errorf("invalid setting %s in config file: %w", key, err)
+		}
+		os.Setenv(name, encoded)
+	}
+	return nil
+}
+
+// encodeSetting encodes the value like Drone does, joining lists of scalar
+// values with commas and encoding maps and other lists as JSON
+func encodeSetting(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			switch v.(type) {
+			case map[string]interface{}, []interface{}:
+				return encodeJSON(value)
+			}
+			values = append(values, fmt.Sprint(v))
+		}
+		return strings.Join(values, ","), nil
+	case map[string]interface{}:
+		return encodeJSON(value)
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// encodeJSON encodes the value as JSON
+func encodeJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// flagValue returns the value of the flag in the arguments, for settings
+// needed before the flags are parsed
+func flagValue(args []string, name string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		arg = strings.TrimLeft(arg, "-")
+		if value, ok := strings.CutPrefix(arg, name+"="); ok {
+			return value, true
+		}
+		if arg == name && i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// hasFlag reports whether the flag is given in the arguments
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		arg = strings.TrimLeft(arg, "-")
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// inheritFlags applies the flags given before the command name to the
+// command, as urfave/cli only reads the flags given after it. Flags given
+// after the command name take precedence.
+func inheritFlags(c *cli.Context) error {
+	args := os.Args[1:]
+	before, after := args, []string{}
+	if i := slices.Index(args, c.Command.Name); i >= 0 {
+		before, after = args[:i], args[i+1:]
+	}
+
+	parent := c.Parent()
+	for _, name := range c.GlobalFlagNames() {
+		if !hasFlag(before, name) || hasFlag(after, name) {
+			continue
+		}
+
+		if values, ok := c.Generic(name).(*cli.StringSlice); ok {
+			*values = slices.Clone(parent.StringSlice(name))
+			continue
+		}
+		if err := c.Set(name, parent.Generic(name).(interface{ String() string }).String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,8 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
+	"github.com/drone-plugins/drone-email/pkg/emailer"
 	log "github.com/sirupsen/logrus"
 	"github.com/joho/godotenv"
 	"github.com/urfave/cli"
@@ -11,6 +20,9 @@ import (
 func main() {
 	// Load env-file if it exists first
 	envFile, envFileSet := os.LookupEnv("PLUGIN_ENV_FILE")
+	if value, ok := flagValue(os.Args[1:], "env.file"); ok {
+		envFile, envFileSet = value, true
+	}
 	if !envFileSet {
 		envFile = "/run/drone/env"
 	}
@@ -18,12 +30,59 @@ func main() {
 		godotenv.Overload(envFile)
 	}
 
+	// Load the settings from the config file, not overriding the environment
+	configFile := os.Getenv("PLUGIN_CONFIG_FILE")
+	if value, ok := flagValue(os.Args[1:], "config.file"); ok {
+		configFile = value
+	}
+	if configFile != "" {
+		if err := loadConfigFile(configFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Fill in the Drone environment from the variables of other CI platforms
+	platform := os.Getenv("PLUGIN_PLATFORM")
+	if value, ok := flagValue(os.Args[1:], "platform"); ok {
+		platform = value
+	}
+	if err := loadPlatformEnv(platform); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := newApp().Run(os.Args); err != nil {
+		log.Fatal(err)
+		os.Exit(1)
+	}
+}
+
+// newApp creates the cli app with the settings and the commands
+func newApp() *cli.App {
 	app := cli.NewApp()
-	app.Name = "email plugin"
-	app.Usage = "email plugin"
+	app.Name = "drone-email"
+	app.Usage = "send build notifications via email"
+	app.Description = "Every setting is available as flag and as environment variable. Flags take\n" +
+		"   precedence over environment variables, which take precedence over the config file."
 	app.Action = run
-	app.Version = "2.0.2"
-	app.Flags = []cli.Flag{
+	app.Version = emailer.ReadBuildInfo().String()
+	flags := []cli.Flag{
+		// Settings read before the other settings
+		cli.StringFlag{
+			Name:   "env.file",
+			Usage:  "env file loaded into the environment, defaults to /run/drone/env",
+			EnvVar: "PLUGIN_ENV_FILE",
+		},
+		cli.StringFlag{
+			Name:   "config.file",
+			Usage:  "yaml or json file with the settings",
+			EnvVar: "PLUGIN_CONFIG_FILE",
+		},
+		cli.StringFlag{
+			Name:   "platform",
+			Usage:  "ci platform to read the build information from (drone, harness, woodpecker, gitlab), detected by default",
+			EnvVar: "PLUGIN_PLATFORM",
+		},
+
 		// Plugin environment
 		cli.StringFlag{
 			Name:   "from",
@@ -47,7 +106,7 @@ func main() {
 		},
 		cli.IntFlag{
 			Name:   "port",
-			Value:  DefaultPort,
+			Value:  emailer.DefaultPort,
 			Usage:  "smtp port",
 			EnvVar: "EMAIL_PORT,PLUGIN_PORT",
 		},
@@ -88,32 +147,653 @@ func main() {
 		},
 		cli.StringFlag{
 			Name:   "template.subject",
-			Value:  DefaultSubject,
+			Value:  emailer.DefaultSubject,
 			Usage:  "subject template",
 			EnvVar: "PLUGIN_SUBJECT",
 		},
 		cli.StringFlag{
 			Name:   "template.body",
-			Value:  DefaultTemplate,
+			Value:  emailer.DefaultTemplate,
 			Usage:  "body template",
 			EnvVar: "PLUGIN_BODY",
 		},
+		cli.StringFlag{
+			Name:   "template.text",
+			Value:  emailer.DefaultTextTemplate,
+			Usage:  "plain text body template used in text format, or instead of converting the HTML body in html format",
+			EnvVar: "PLUGIN_TEXT_BODY",
+		},
+		cli.StringFlag{
+			Name:   "message.format",
+			Value:  "multipart",
+			Usage:  "format of the body, multipart with HTML and plain text, text only or html only",
+			EnvVar: "PLUGIN_FORMAT",
+		},
+		cli.StringFlag{
+			Name:   "text.links",
+			Usage:  "links in the plain text converted from HTML, inline, footnotes or omit",
+			Value:  "inline",
+			EnvVar: "PLUGIN_TEXT_LINKS",
+		},
+		cli.StringFlag{
+			Name:   "text.tables",
+			Usage:  "tables in the plain text converted from HTML, plain or pretty",
+			Value:  "plain",
+			EnvVar: "PLUGIN_TEXT_TABLES",
+		},
+		cli.IntFlag{
+			Name:   "text.width",
+			Usage:  "line width the plain text converted from HTML is wrapped at, not wrapped by default",
+			EnvVar: "PLUGIN_TEXT_WIDTH",
+		},
 		cli.StringFlag{
 			Name:   "attachment",
-			Usage:  "attachment filename",
+			Usage:  "attachment filename or glob pattern, optionally renamed with =name or embedded with inline: prefix",
 			EnvVar: "PLUGIN_ATTACHMENT",
 		},
 		cli.StringSliceFlag{
 			Name:   "attachments",
-			Usage:  "attachment filename(s)",
+			Usage:  "attachment filename(s) or glob pattern(s), optionally renamed with =name or embedded with inline: prefix",
 			EnvVar: "PLUGIN_ATTACHMENTS",
 		},
 		cli.StringFlag{
 			Name:   "clienthostname",
-			Value:  DefaultClientHostname,
+			Value:  emailer.DefaultClientHostname,
 			Usage:  "smtp client hostname",
 			EnvVar: "EMAIL_CLIENTHOSTNAME,PLUGIN_CLIENTHOSTNAME",
 		},
+		cli.StringFlag{
+			Name:   "api.server",
+			Usage:  "drone server url used for api requests",
+			EnvVar: "PLUGIN_API_SERVER",
+		},
+		cli.StringFlag{
+			Name:   "api.token",
+			Usage:  "drone api token",
+			EnvVar: "PLUGIN_API_TOKEN",
+		},
+		cli.IntFlag{
+			Name:   "history",
+			Usage:  "number of previous builds of the branch to expose as history",
+			EnvVar: "PLUGIN_HISTORY",
+		},
+		cli.BoolFlag{
+			Name:   "attach.logs",
+			Usage:  "attach the logs of failed steps fetched from the api",
+			EnvVar: "PLUGIN_ATTACH_LOGS",
+		},
+		cli.BoolFlag{
+			Name:   "attach.logs.gzip",
+			Usage:  "gzip the attached logs",
+			EnvVar: "PLUGIN_ATTACH_LOGS_GZIP",
+		},
+		cli.StringFlag{
+			Name:   "log.file",
+			Usage:  "log file exposed to the templates instead of the api logs",
+			EnvVar: "PLUGIN_LOG_FILE",
+		},
+		cli.StringSliceFlag{
+			Name:   "junit.reports",
+			Usage:  "junit xml report file(s) or glob pattern(s)",
+			EnvVar: "PLUGIN_JUNIT_REPORTS",
+		},
+		cli.StringFlag{
+			Name:   "coverage.report",
+			Usage:  "coverage report (cobertura, go cover profile or lcov)",
+			EnvVar: "PLUGIN_COVERAGE_REPORT",
+		},
+		cli.StringFlag{
+			Name:   "coverage.baseline",
+			Usage:  "coverage report the coverage delta is computed against",
+			EnvVar: "PLUGIN_COVERAGE_BASELINE",
+		},
+		cli.StringSliceFlag{
+			Name:   "artifact.links",
+			Usage:  "artifact download links as name=url, both templated",
+			EnvVar: "PLUGIN_ARTIFACT_LINKS",
+		},
+		cli.StringFlag{
+			Name:   "artifact.links.file",
+			Usage:  "json file containing artifact download links",
+			EnvVar: "PLUGIN_ARTIFACT_LINKS_FILE",
+		},
+		cli.StringSliceFlag{
+			Name:   "embed.images",
+			Usage:  "image file(s) embedded inline and referenced via cid:filename",
+			EnvVar: "PLUGIN_EMBED_IMAGES",
+		},
+		cli.BoolFlag{
+			Name:   "badge",
+			Usage:  "embed a build status badge",
+			EnvVar: "PLUGIN_BADGE",
+		},
+		cli.StringFlag{
+			Name:   "badge.url",
+			Usage:  "url to fetch the status badge from instead of generating it",
+			EnvVar: "PLUGIN_BADGE_URL",
+		},
+		cli.BoolFlag{
+			Name:   "diffstat",
+			Usage:  "compute diff stats of the commit range using git",
+			EnvVar: "PLUGIN_DIFFSTAT",
+		},
+		cli.BoolFlag{
+			Name:   "extract.errors",
+			Usage:  "extract error lines from the logs",
+			EnvVar: "PLUGIN_EXTRACT_ERRORS",
+		},
+		cli.StringSliceFlag{
+			Name:   "error.patterns",
+			Usage:  "regular expressions matching error lines, replacing the defaults",
+			EnvVar: "PLUGIN_ERROR_PATTERNS",
+		},
+		cli.IntFlag{
+			Name:   "error.lines",
+			Value:  emailer.DefaultErrorLines,
+			Usage:  "maximum number of extracted error lines",
+			EnvVar: "PLUGIN_ERROR_LINES",
+		},
+		cli.BoolFlag{
+			Name:   "calendar",
+			Usage:  "attach an icalendar entry for deployments",
+			EnvVar: "PLUGIN_CALENDAR",
+		},
+		cli.StringFlag{
+			Name:   "calendar.summary",
+			Value:  emailer.DefaultCalendarSummary,
+			Usage:  "summary template of the calendar entry",
+			EnvVar: "PLUGIN_CALENDAR_SUMMARY",
+		},
+		cli.BoolFlag{
+			Name:   "qrcode",
+			Usage:  "embed a qr code of the build link",
+			EnvVar: "PLUGIN_QRCODE",
+		},
+		cli.IntFlag{
+			Name:   "qrcode.size",
+			Value:  emailer.DefaultQRCodeSize,
+			Usage:  "size of the qr code in pixels",
+			EnvVar: "PLUGIN_QRCODE_SIZE",
+		},
+		cli.BoolFlag{
+			Name:   "classify.failures",
+			Usage:  "classify failed builds based on logs and exit codes",
+			EnvVar: "PLUGIN_CLASSIFY_FAILURES",
+		},
+		cli.StringSliceFlag{
+			Name:   "failure.rules",
+			Usage:  "failure classification rules as category=pattern",
+			EnvVar: "PLUGIN_FAILURE_RULES",
+		},
+		cli.StringSliceFlag{
+			Name:   "failure.hints",
+			Usage:  "remediation hints per failure category as category=hint",
+			EnvVar: "PLUGIN_FAILURE_HINTS",
+		},
+		cli.BoolFlag{
+			Name:   "attach.html",
+			Usage:  "attach the rendered html body as build-report.html",
+			EnvVar: "PLUGIN_ATTACH_HTML",
+		},
+		cli.StringFlag{
+			Name:   "brand.name",
+			Usage:  "brand name shown by the built-in templates",
+			EnvVar: "PLUGIN_BRAND_NAME",
+		},
+		cli.StringFlag{
+			Name:   "brand.logo.url",
+			Usage:  "brand logo url shown by the built-in templates",
+			EnvVar: "PLUGIN_BRAND_LOGO_URL",
+		},
+		cli.StringFlag{
+			Name:   "brand.color",
+			Usage:  "brand color used by the built-in templates",
+			EnvVar: "PLUGIN_BRAND_COLOR",
+		},
+		cli.StringFlag{
+			Name:   "template.footer",
+			Usage:  "footer template appended to every body",
+			EnvVar: "PLUGIN_FOOTER",
+		},
+		cli.StringFlag{
+			Name:   "attach.dir",
+			Usage:  "directory attached as zip archive",
+			EnvVar: "PLUGIN_ATTACH_DIR",
+		},
+		cli.StringFlag{
+			Name:   "attach.dir.max.size",
+			Usage:  "maximum size of the zip archive, e.g. 10MB",
+			EnvVar: "PLUGIN_ATTACH_DIR_MAX_SIZE",
+		},
+		cli.StringFlag{
+			Name:   "max.attachment.size",
+			Usage:  "maximum size of a single attachment, e.g. 10MB",
+			EnvVar: "PLUGIN_MAX_ATTACHMENT_SIZE",
+		},
+		cli.StringFlag{
+			Name:   "max.message.size",
+			Usage:  "maximum size of the message including attachments, e.g. 25MB",
+			EnvVar: "PLUGIN_MAX_MESSAGE_SIZE",
+		},
+		cli.StringFlag{
+			Name:   "oversize.action",
+			Value:  emailer.OversizeSkip,
+			Usage:  "action for attachments exceeding the size limits (skip, fail)",
+			EnvVar: "PLUGIN_OVERSIZE_ACTION",
+		},
+		cli.StringFlag{
+			Name:   "compress.attachments",
+			Value:  emailer.CompressNone,
+			Usage:  "compress attachments individually (gzip) or bundled (zip)",
+			EnvVar: "PLUGIN_COMPRESS_ATTACHMENTS",
+		},
+		cli.DurationFlag{
+			Name:   "download.timeout",
+			Value:  emailer.DefaultDownloadTimeout,
+			Usage:  "timeout for downloading attachments from urls",
+			EnvVar: "PLUGIN_DOWNLOAD_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "download.max.size",
+			Usage:  "maximum size of attachments downloaded from urls, e.g. 10MB",
+			EnvVar: "PLUGIN_DOWNLOAD_MAX_SIZE",
+		},
+		cli.StringFlag{
+			Name:   "download.header",
+			Usage:  "header sent when downloading attachments, e.g. Authorization: Bearer token",
+			EnvVar: "PLUGIN_DOWNLOAD_HEADER",
+		},
+		cli.BoolFlag{
+			Name:   "attachments.required",
+			Usage:  "fail if attachments are missing",
+			EnvVar: "PLUGIN_ATTACHMENTS_REQUIRED",
+		},
+		cli.StringSliceFlag{
+			Name:   "attachment.types",
+			Usage:  "content types of attachments as name pattern=type",
+			EnvVar: "PLUGIN_ATTACHMENT_TYPES",
+		},
+		cli.StringFlag{
+			Name:   "attach.stdin",
+			Usage:  "attach the content piped to stdin with the given name",
+			EnvVar: "PLUGIN_ATTACH_STDIN",
+		},
+		cli.BoolFlag{
+			Name:   "attachment.checksums",
+			Usage:  "list the sha-256 checksums of attachments in the body",
+			EnvVar: "PLUGIN_ATTACHMENT_CHECKSUMS",
+		},
+		cli.StringSliceFlag{
+			Name:   "attachment.extensions",
+			Usage:  "file extensions allowed to be attached, blocks executables if unset",
+			EnvVar: "PLUGIN_ATTACHMENT_EXTENSIONS",
+		},
+		cli.StringFlag{
+			Name:   "body.encoding",
+			Usage:  "transfer encoding of the body, quoted-printable, base64 or 8bit",
+			EnvVar: "PLUGIN_BODY_ENCODING",
+		},
+		cli.StringFlag{
+			Name:   "attachment.encoding",
+			Usage:  "transfer encoding of attachments, base64 or 8bit",
+			EnvVar: "PLUGIN_ATTACHMENT_ENCODING",
+		},
+		cli.StringFlag{
+			Name:   "custom.headers",
+			Usage:  "json object of additional headers added to every message",
+			EnvVar: "PLUGIN_CUSTOM_HEADERS",
+		},
+		cli.StringSliceFlag{
+			Name:   "priority",
+			Usage:  "priority of the message, high, normal or low, optionally by build status as status=priority",
+			EnvVar: "PLUGIN_PRIORITY",
+		},
+		cli.BoolFlag{
+			Name:   "thread",
+			Usage:  "group the notifications of a repository and branch or pull request into a single thread",
+			EnvVar: "PLUGIN_THREAD",
+		},
+		cli.StringFlag{
+			Name:   "thread.key",
+			Usage:  "template of the key identifying the thread",
+			EnvVar: "PLUGIN_THREAD_KEY",
+		},
+		cli.StringFlag{
+			Name:   "list.id",
+			Usage:  "list id identifying the notifications, e.g. ci-notifications.repo.example",
+			EnvVar: "PLUGIN_LIST_ID",
+		},
+		cli.StringSliceFlag{
+			Name:   "list.unsubscribe",
+			Usage:  "mailto: or http(s) urls to unsubscribe from the notifications",
+			EnvVar: "PLUGIN_LIST_UNSUBSCRIBE",
+		},
+		cli.BoolTFlag{
+			Name:   "auto.submitted",
+			Usage:  "mark messages as auto-generated to suppress auto-replies",
+			EnvVar: "PLUGIN_AUTO_SUBMITTED",
+		},
+		cli.BoolFlag{
+			Name:   "drone.headers",
+			Usage:  "add X-Drone-* headers describing the build",
+			EnvVar: "PLUGIN_DRONE_HEADERS",
+		},
+		cli.StringSliceFlag{
+			Name:   "read.receipt",
+			Usage:  "addresses read receipts are requested to",
+			EnvVar: "PLUGIN_READ_RECEIPT",
+		},
+		cli.StringFlag{
+			Name:   "sender",
+			Usage:  "sender address if different from the from address",
+			EnvVar: "PLUGIN_SENDER",
+		},
+		cli.StringFlag{
+			Name:   "envelope.from",
+			Usage:  "envelope from address receiving bounces",
+			EnvVar: "PLUGIN_ENVELOPE_FROM",
+		},
+		cli.StringFlag{
+			Name:   "message.id.domain",
+			Usage:  "domain of generated message ids",
+			EnvVar: "PLUGIN_MESSAGE_ID_DOMAIN",
+		},
+		cli.StringFlag{
+			Name:   "verp",
+			Usage:  "bounce address the repository, build and recipient are encoded into",
+			EnvVar: "PLUGIN_VERP",
+		},
+		cli.BoolFlag{
+			Name:   "subject.tag",
+			Usage:  "prepend the repository and build number to the subject",
+			EnvVar: "PLUGIN_SUBJECT_TAG",
+		},
+		cli.StringFlag{
+			Name:   "reply.to",
+			Usage:  "reply-to address, e.g. {{ commit.author.email }}",
+			EnvVar: "PLUGIN_REPLY_TO",
+		},
+		cli.StringFlag{
+			Name:   "smime.certificate",
+			Usage:  "pem encoded s/mime certificate chain or path to it",
+			EnvVar: "PLUGIN_SMIME_CERTIFICATE",
+		},
+		cli.StringFlag{
+			Name:   "smime.key",
+			Usage:  "pem encoded s/mime private key or path to it",
+			EnvVar: "PLUGIN_SMIME_KEY",
+		},
+		cli.StringFlag{
+			Name:   "smime.pkcs12",
+			Usage:  "base64 encoded pkcs12 bundle with s/mime certificate and key or path to it",
+			EnvVar: "PLUGIN_SMIME_PKCS12",
+		},
+		cli.StringFlag{
+			Name:   "smime.password",
+			Usage:  "password of the pkcs12 bundle",
+			EnvVar: "PLUGIN_SMIME_PASSWORD",
+		},
+		cli.StringFlag{
+			Name:   "pgp.keyring",
+			Usage:  "file or directory of public keys messages are encrypted with per recipient",
+			EnvVar: "PLUGIN_PGP_KEYRING",
+		},
+		cli.StringFlag{
+			Name:   "pgp.signing.key",
+			Usage:  "armored private key encrypted messages are signed with or path to it",
+			EnvVar: "PLUGIN_PGP_SIGNING_KEY",
+		},
+		cli.StringFlag{
+			Name:   "pgp.passphrase",
+			Usage:  "passphrase of the pgp signing key",
+			EnvVar: "PLUGIN_PGP_PASSPHRASE",
+		},
+		cli.StringSliceFlag{
+			Name:   "redact.env",
+			Usage:  "environment variables whose values are scrubbed from the log output",
+			EnvVar: "PLUGIN_REDACT_ENV",
+		},
+		cli.BoolFlag{
+			Name:   "sanitize.html",
+			Usage:  "escape html in commit messages, author names and branches",
+			EnvVar: "PLUGIN_SANITIZE_HTML",
+		},
+		cli.StringFlag{
+			Name:   "log.recipients",
+			Value:  emailer.LogRecipientsMasked,
+			Usage:  "logging of recipient addresses (none, masked, full)",
+			EnvVar: "PLUGIN_LOG_RECIPIENTS",
+		},
+		cli.StringFlag{
+			Name:   "audit.log",
+			Usage:  "file a json line per sent message is appended to",
+			EnvVar: "PLUGIN_AUDIT_LOG",
+		},
+		cli.BoolFlag{
+			Name:   "tls.required",
+			Usage:  "fail instead of sending unencrypted if starttls is unavailable",
+			EnvVar: "PLUGIN_TLS_REQUIRED",
+		},
+		cli.StringFlag{
+			Name:   "preflight",
+			Value:  emailer.PreflightOff,
+			Usage:  "check the spf and dmarc records of the from domain (off, warn, fail)",
+			EnvVar: "PLUGIN_PREFLIGHT",
+		},
+		cli.BoolFlag{
+			Name:   "dry.run",
+			Usage:  "build the messages without sending them",
+			EnvVar: "PLUGIN_DRY_RUN",
+		},
+		cli.StringFlag{
+			Name:   "output.dir",
+			Usage:  "directory the messages are saved to as .eml files",
+			EnvVar: "PLUGIN_OUTPUT_DIR",
+		},
+		cli.StringFlag{
+			Name:   "log.format",
+			Usage:  "format of the log output, text or json",
+			Value:  emailer.LogFormatText,
+			EnvVar: "PLUGIN_LOG_FORMAT",
+		},
+		cli.StringFlag{
+			Name:   "log.level",
+			Usage:  "minimum level of the log output",
+			Value:  "info",
+			EnvVar: "PLUGIN_LOG_LEVEL",
+		},
+		cli.BoolFlag{
+			Name:   "debug.smtp",
+			Usage:  "log the conversation with the smtp server",
+			EnvVar: "PLUGIN_DEBUG_SMTP",
+		},
+		cli.StringFlag{
+			Name:   "metrics.url",
+			Usage:  "prometheus pushgateway (http) or statsd (udp) url to push delivery metrics to",
+			EnvVar: "PLUGIN_METRICS_URL",
+		},
+		cli.BoolTFlag{
+			Name:   "fail.on.error",
+			Usage:  "fail the step if the email could not be sent",
+			EnvVar: "PLUGIN_FAIL_ON_ERROR",
+		},
+		cli.BoolFlag{
+			Name:   "fail.on.partial",
+			Usage:  "fail the step if the email could not be sent to any of the recipients",
+			EnvVar: "PLUGIN_FAIL_ON_PARTIAL",
+		},
+		cli.StringFlag{
+			Name:   "report.file",
+			Usage:  "file the json delivery report is written to",
+			EnvVar: "PLUGIN_REPORT_FILE",
+		},
+		cli.StringFlag{
+			Name:   "card.path",
+			Usage:  "path the card summarizing the notification is written to",
+			EnvVar: "DRONE_CARD_PATH",
+		},
+		cli.StringFlag{
+			Name:   "otlp.endpoint",
+			Usage:  "base url of the opentelemetry collector the traces are exported to",
+			EnvVar: "PLUGIN_OTLP_ENDPOINT",
+		},
+		cli.StringSliceFlag{
+			Name:   "otlp.headers",
+			Usage:  "headers sent to the opentelemetry collector as name=value",
+			EnvVar: "PLUGIN_OTLP_HEADERS",
+		},
+		cli.BoolFlag{
+			Name:   "check.only",
+			Usage:  "check the connection to the smtp server without sending email",
+			EnvVar: "PLUGIN_CHECK_ONLY",
+		},
+		cli.StringFlag{
+			Name:   "callback.url",
+			Usage:  "url the delivery report is posted to after sending",
+			EnvVar: "PLUGIN_CALLBACK_URL",
+		},
+		cli.StringFlag{
+			Name:   "archive.url",
+			Usage:  "s3, gcs or azure blob storage bucket url the sent messages are uploaded to",
+			EnvVar: "PLUGIN_ARCHIVE_URL",
+		},
+		cli.DurationFlag{
+			Name:   "timeout",
+			Usage:  "time after which the delivery is aborted, e.g. 5m",
+			EnvVar: "PLUGIN_TIMEOUT",
+		},
+		cli.IntFlag{
+			Name:   "concurrency",
+			Usage:  "number of smtp connections the messages are sent over concurrently",
+			Value:  1,
+			EnvVar: "PLUGIN_CONCURRENCY",
+		},
+		cli.StringFlag{
+			Name:   "spool.dir",
+			Usage:  "directory undelivered messages are kept in and sent from by the next run",
+			EnvVar: "PLUGIN_SPOOL_DIR",
+		},
+		cli.BoolFlag{
+			Name:   "aggregate",
+			Usage:  "send one email with the outcomes of all jobs of the build",
+			EnvVar: "PLUGIN_AGGREGATE",
+		},
+		cli.StringFlag{
+			Name:   "aggregate.dir",
+			Usage:  "directory shared by the jobs of the build to record their outcomes in",
+			EnvVar: "PLUGIN_AGGREGATE_DIR",
+		},
+		cli.IntFlag{
+			Name:   "aggregate.jobs",
+			Usage:  "number of jobs recording their outcome in the aggregate directory",
+			EnvVar: "PLUGIN_AGGREGATE_JOBS",
+		},
+		cli.DurationFlag{
+			Name:   "aggregate.timeout",
+			Usage:  "time to wait for the other jobs of the build when polling the api, defaults to 10m",
+			EnvVar: "PLUGIN_AGGREGATE_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "digest",
+			Usage:  "collect the build for the next digest or send the digest (collect, send)",
+			EnvVar: "PLUGIN_DIGEST",
+		},
+		cli.StringFlag{
+			Name:   "digest.dir",
+			Usage:  "directory the builds are collected in for the digest",
+			EnvVar: "PLUGIN_DIGEST_DIR",
+		},
+		cli.StringFlag{
+			Name:   "imap.host",
+			Usage:  "imap server a copy of every sent message is stored on",
+			EnvVar: "PLUGIN_IMAP_HOST",
+		},
+		cli.IntFlag{
+			Name:   "imap.port",
+			Usage:  "imap server port",
+			Value:  993,
+			EnvVar: "PLUGIN_IMAP_PORT",
+		},
+		cli.StringFlag{
+			Name:   "imap.username",
+			Usage:  "imap username, defaults to the smtp username",
+			EnvVar: "PLUGIN_IMAP_USERNAME",
+		},
+		cli.StringFlag{
+			Name:   "imap.password",
+			Usage:  "imap password, defaults to the smtp password",
+			EnvVar: "PLUGIN_IMAP_PASSWORD",
+		},
+		cli.StringFlag{
+			Name:   "imap.folder",
+			Usage:  "imap folder the sent messages are stored in",
+			Value:  "CI Notifications",
+			EnvVar: "PLUGIN_IMAP_FOLDER",
+		},
+		cli.IntFlag{
+			Name:   "retries",
+			Usage:  "number of times a message failing temporarily with a 4xx reply is retried",
+			Value:  2,
+			EnvVar: "PLUGIN_RETRIES",
+		},
+		cli.DurationFlag{
+			Name:   "retry.backoff",
+			Usage:  "delay before the first retry, doubled for every further retry, defaults to 5s",
+			EnvVar: "PLUGIN_RETRY_BACKOFF",
+		},
+		cli.DurationFlag{
+			Name:   "greylist.wait",
+			Usage:  "time to wait before retrying a greylisted message unless the server advertises an interval, disabled by default",
+			EnvVar: "PLUGIN_GREYLIST_WAIT",
+		},
+		cli.DurationFlag{
+			Name:   "keepalive",
+			Usage:  "reset reused connections idle for this long and reconnect once if the server dropped them, disabled by default",
+			EnvVar: "PLUGIN_KEEPALIVE",
+		},
+		cli.IntFlag{
+			Name:   "messages.per.connection",
+			Usage:  "number of messages sent over a connection before reconnecting, unlimited by default",
+			EnvVar: "PLUGIN_MESSAGES_PER_CONNECTION",
+		},
+		cli.StringFlag{
+			Name:   "delivery",
+			Usage:  "send a message to each recipient individually or a single message to a batch of recipients",
+			Value:  "individual",
+			EnvVar: "PLUGIN_DELIVERY",
+		},
+		cli.IntFlag{
+			Name:   "batch.size",
+			Usage:  "maximum number of recipients of a single message in batch delivery, defaults to 100",
+			EnvVar: "PLUGIN_BATCH_SIZE",
+		},
+		cli.StringFlag{
+			Name:   "charset",
+			Usage:  "charset of the subject and the bodies",
+			Value:  "UTF-8",
+			EnvVar: "PLUGIN_CHARSET",
+		},
+		cli.BoolFlag{
+			Name:   "force.7bit",
+			Usage:  "send quoted-printable bodies and base64 attachments instead of unencoded 8-bit data",
+			EnvVar: "PLUGIN_FORCE_7BIT",
+		},
+		cli.BoolFlag{
+			Name:   "verify.recipients",
+			Usage:  "remove the recipients the smtp server rejects before sending",
+			EnvVar: "PLUGIN_VERIFY_RECIPIENTS",
+		},
+		cli.StringFlag{
+			Name:   "mailbox.path",
+			Usage:  "mbox file or maildir the sent messages are written to",
+			EnvVar: "PLUGIN_MAILBOX_PATH",
+		},
+		cli.StringFlag{
+			Name:   "mailbox.format",
+			Usage:  "format of the mailbox (mbox, maildir)",
+			Value:  "mbox",
+			EnvVar: "PLUGIN_MAILBOX_FORMAT",
+		},
 
 		// Drone environment
 		// Repo
@@ -178,6 +858,11 @@ func main() {
 			Usage:  "git commit sha",
 			EnvVar: "DRONE_COMMIT_SHA",
 		},
+		cli.StringFlag{
+			Name:   "commit.before",
+			Usage:  "git commit sha before the push",
+			EnvVar: "DRONE_COMMIT_BEFORE",
+		},
 		cli.StringFlag{
 			Name:   "commit.ref",
 			Value:  "refs/heads/master",
@@ -276,7 +961,12 @@ func main() {
 		cli.IntFlag{
 			Name:   "job.number",
 			Usage:  "job number",
-			EnvVar: "DRONE_JOB_NUMBER",
+			EnvVar: "DRONE_JOB_NUMBER,DRONE_STAGE_NUMBER",
+		},
+		cli.StringFlag{
+			Name:   "job.name",
+			Usage:  "job name",
+			EnvVar: "DRONE_STAGE_NAME",
 		},
 		cli.StringFlag{
 			Name:   "job.status",
@@ -333,21 +1023,208 @@ func main() {
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
-		os.Exit(1)
+	// Every command accepts all settings, also after the command name
+	app.Flags = flags
+	app.Commands = []cli.Command{
+		{
+			Name:   "send",
+			Usage:  "send the notification, the default",
+			Flags:  flags,
+			Before: inheritFlags,
+			Action: run,
+		},
+		{
+			Name:  "preview",
+			Usage: "write the rendered notification to stdout without sending it",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "context",
+					Usage: "json file with the build data, e.g. {\"build\": {\"status\": \"failure\"}}",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "format of the preview, html, text or eml",
+					Value: emailer.PreviewHTML,
+				},
+			}, flags...),
+			Before: inheritFlags,
+			Action: preview,
+		},
+		{
+			Name:   "validate",
+			Usage:  "check the settings and the subject, body and footer templates for errors",
+			Flags:  flags,
+			Before: inheritFlags,
+			Action: validate,
+		},
+		{
+			Name:   "check",
+			Usage:  "check the connection to the smtp server without sending email",
+			Flags:  flags,
+			Before: inheritFlags,
+			Action: check,
+		},
+		{
+			Name:  "serve",
+			Usage: "receive drone or harness webhooks and send the notification for every finished build",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:   "listen.addr",
+					Usage:  "address the webhook server listens on",
+					Value:  ":3000",
+					EnvVar: "PLUGIN_LISTEN_ADDR",
+				},
+				cli.StringFlag{
+					Name:   "webhook.secret",
+					Usage:  "secret verifying the signature of the webhooks",
+					EnvVar: "PLUGIN_WEBHOOK_SECRET,DRONE_WEBHOOK_SECRET",
+				},
+			}, flags...),
+			Before: inheritFlags,
+			Action: serve,
+		},
 	}
+	return app
 }
 
 func run(c *cli.Context) error {
+	plugin, err := newPlugin(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	// Configuration errors always fail, email problems only if enabled
+	if err := plugin.ExecContext(ctx); err != nil {
+		var configErr *emailer.ConfigError
+		if !c.BoolT("fail.on.error") && !errors.As(err, &configErr) {
+			log.Errorf("Ignoring error as fail_on_error is disabled: %v", err)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func preview(c *cli.Context) error {
+	plugin, err := newPlugin(c)
+	if err != nil {
+		return err
+	}
+
+	// Build data from the file takes precedence over the environment
+	if path := c.String("context"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read context: %w", err)
+		}
+		if err := json.Unmarshal(data, &plugin); err != nil {
+			return fmt.Errorf("could not parse context: %w", err)
+		}
+	}
+
+	plugin.Config.Preview = c.String("format")
+	return plugin.Exec()
+}
+
+func validate(c *cli.Context) error {
+	plugin, err := newPlugin(c)
+	if err != nil {
+		return err
+	}
+	if err := plugin.ValidateConfig(); err != nil {
+		var configErr *emailer.ConfigError
+		if errors.As(err, &configErr) {
+			for _, problem := range configErr.Problems {
+				log.Errorf("Invalid setting %v", problem)
+			}
+		}
+		return err
+	}
+	if err := plugin.Validate(); err != nil {
+		return err
+	}
+	log.Info("Settings and templates are valid")
+	return nil
+}
+
+func check(c *cli.Context) error {
+	plugin, err := newPlugin(c)
+	if err != nil {
+		return err
+	}
+	plugin.Config.CheckOnly = true
+
+	ctx, stop := signalContext()
+	defer stop()
+	return plugin.ExecContext(ctx)
+}
+
+// signalContext returns a context canceled on SIGINT or SIGTERM, as sent when
+// the step is canceled or timed out, to abort before the step is killed
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+func serve(c *cli.Context) error {
+	plugin, err := newPlugin(c)
+	if err != nil {
+		return err
+	}
+
+	secret := c.String("webhook.secret")
+	if secret == "" {
+		log.Warn("Webhook signatures are not verified as no webhook secret is set")
+	}
+
+	http.Handle("/", emailer.NewWebhookHandler(plugin, secret))
+	log.Infof("Listening for webhooks on %s", c.String("listen.addr"))
+	return http.ListenAndServe(c.String("listen.addr"), nil)
+}
+
+// newPlugin creates the plugin from the settings
+func newPlugin(c *cli.Context) (emailer.Plugin, error) {
+	if err := emailer.ConfigureLogging(c.String("log.format"), c.String("log.level")); err != nil {
+		return emailer.Plugin{}, err
+	}
+	log.Infof("drone-email %s", emailer.ReadBuildInfo())
+
+	// Scrub secrets from the log output
+	_, downloadCredentials, _ := strings.Cut(c.String("download.header"), ":")
+	secrets := []string{
+		c.String("password"),
+		c.String("api.token"),
+		downloadCredentials,
+		c.String("smime.password"),
+		c.String("pgp.passphrase"),
+		c.String("imap.password"),
+		c.String("webhook.secret"),
+	}
+	for _, setting := range []string{"archive.url", "metrics.url", "callback.url"} {
+		secrets = append(secrets, emailer.URLCredentials(c.String(setting))...)
+	}
+	for _, header := range c.StringSlice("otlp.headers") {
+		_, value, _ := strings.Cut(header, "=")
+		secrets = append(secrets, value)
+	}
+	emailer.RedactSecrets(secrets, c.StringSlice("redact.env"))
 
 	var fromAddress string = c.String("from")
 	if fromAddress == "" {
 		fromAddress = c.String("from.address")
 	}
 
-	plugin := Plugin{
-		Repo: Repo{
+	var customHeaders map[string]string
+	if headers := c.String("custom.headers"); headers != "" {
+		if err := json.Unmarshal([]byte(headers), &customHeaders); err != nil {
+			return emailer.Plugin{}, fmt.Errorf("could not parse custom headers: %w", err)
+		}
+	}
+
+	return emailer.Plugin{
+		Repo: emailer.Repo{
 			FullName: c.String("repo.fullName"),
 			Owner:    c.String("repo.owner"),
 			Name:     c.String("repo.name"),
@@ -358,22 +1235,23 @@ func run(c *cli.Context) error {
 			Private:  c.Bool("repo.private"),
 			Trusted:  c.Bool("repo.trusted"),
 		},
-		Remote: Remote{
+		Remote: emailer.Remote{
 			URL: c.String("remote.url"),
 		},
-		Commit: Commit{
+		Commit: emailer.Commit{
 			Sha:     c.String("commit.sha"),
+			Before:  c.String("commit.before"),
 			Ref:     c.String("commit.ref"),
 			Branch:  c.String("commit.branch"),
 			Link:    c.String("commit.link"),
 			Message: c.String("commit.message"),
-			Author: Author{
+			Author: emailer.Author{
 				Name:   c.String("commit.author.name"),
 				Email:  c.String("commit.author.email"),
 				Avatar: c.String("commit.author.avatar"),
 			},
 		},
-		Build: Build{
+		Build: emailer.Build{
 			Number:   c.Int("build.number"),
 			Event:    c.String("build.event"),
 			Status:   c.String("build.status"),
@@ -382,47 +1260,163 @@ func run(c *cli.Context) error {
 			Started:  float64(c.Int64("build.started")),
 			Finished: float64(c.Int64("build.finished")),
 		},
-		Prev: Prev{
-			Build: PrevBuild{
+		Prev: emailer.Prev{
+			Build: emailer.PrevBuild{
 				Status: c.String("prev.build.status"),
 				Number: c.Int("prev.build.number"),
 			},
-			Commit: PrevCommit{
+			Commit: emailer.PrevCommit{
 				Sha: c.String("prev.commit.sha"),
 			},
 		},
-		Job: Job{
+		Job: emailer.Job{
+			Number:   c.Int("job.number"),
+			Name:     c.String("job.name"),
 			Status:   c.String("job.status"),
 			ExitCode: c.Int("job.exitCode"),
 			Started:  float64(c.Int64("job.started")),
 			Finished: float64(c.Int64("job.finished")),
 		},
-		Yaml: Yaml{
+		Yaml: emailer.Yaml{
 			Signed:   c.Bool("yaml.signed"),
 			Verified: c.Bool("yaml.verified"),
 		},
 		Tag:         c.String("tag"),
 		PullRequest: c.Int("pullRequest"),
 		DeployTo:    c.String("deployTo"),
-		Config: Config{
-			FromAddress:    fromAddress,
-			FromName:       c.String("from.name"),
-			Host:           c.String("host"),
-			Port:           c.Int("port"),
-			Username:       c.String("username"),
-			Password:       c.String("password"),
-			SkipVerify:     c.Bool("skip.verify"),
-			NoStartTLS:     c.Bool("no.starttls"),
-			Recipients:     c.StringSlice("recipients"),
-			RecipientsFile: c.String("recipients.file"),
-			RecipientsOnly: c.Bool("recipients.only"),
-			Subject:        c.String("template.subject"),
-			Body:           c.String("template.body"),
-			Attachment:     c.String("attachment"),
-			Attachments:    c.StringSlice("attachments"),
-			ClientHostname: c.String("clienthostname"),
+		Config: emailer.Config{
+			FromAddress:          fromAddress,
+			FromName:             c.String("from.name"),
+			Host:                 c.String("host"),
+			Port:                 c.Int("port"),
+			Username:             c.String("username"),
+			Password:             c.String("password"),
+			SkipVerify:           c.Bool("skip.verify"),
+			NoStartTLS:           c.Bool("no.starttls"),
+			Recipients:           c.StringSlice("recipients"),
+			RecipientsFile:       c.String("recipients.file"),
+			RecipientsOnly:       c.Bool("recipients.only"),
+			Subject:              c.String("template.subject"),
+			Body:                 c.String("template.body"),
+			TextBody:             c.String("template.text"),
+			Format:               c.String("message.format"),
+			TextLinks:            c.String("text.links"),
+			TextTables:           c.String("text.tables"),
+			TextWidth:            c.Int("text.width"),
+			Attachment:           c.String("attachment"),
+			Attachments:          c.StringSlice("attachments"),
+			ClientHostname:       c.String("clienthostname"),
+			APIServer:            c.String("api.server"),
+			APIToken:             c.String("api.token"),
+			History:              c.Int("history"),
+			AttachLogs:           c.Bool("attach.logs"),
+			AttachLogsGzip:       c.Bool("attach.logs.gzip"),
+			LogFile:              c.String("log.file"),
+			JUnitReports:         c.StringSlice("junit.reports"),
+			CoverageReport:       c.String("coverage.report"),
+			CoverageBaseline:     c.String("coverage.baseline"),
+			ArtifactLinks:        c.StringSlice("artifact.links"),
+			ArtifactLinksFile:    c.String("artifact.links.file"),
+			EmbedImages:          c.StringSlice("embed.images"),
+			Badge:                c.Bool("badge"),
+			BadgeURL:             c.String("badge.url"),
+			DiffStat:             c.Bool("diffstat"),
+			ExtractErrors:        c.Bool("extract.errors"),
+			ErrorPatterns:        c.StringSlice("error.patterns"),
+			ErrorLines:           c.Int("error.lines"),
+			Calendar:             c.Bool("calendar"),
+			CalendarSummary:      c.String("calendar.summary"),
+			QRCode:               c.Bool("qrcode"),
+			QRCodeSize:           c.Int("qrcode.size"),
+			ClassifyFailures:     c.Bool("classify.failures"),
+			FailureRules:         c.StringSlice("failure.rules"),
+			FailureHints:         c.StringSlice("failure.hints"),
+			AttachHTML:           c.Bool("attach.html"),
+			BrandName:            c.String("brand.name"),
+			BrandLogoURL:         c.String("brand.logo.url"),
+			BrandColor:           c.String("brand.color"),
+			Footer:               c.String("template.footer"),
+			AttachDir:            c.String("attach.dir"),
+			AttachDirMaxSize:     c.String("attach.dir.max.size"),
+			MaxAttachmentSize:    c.String("max.attachment.size"),
+			MaxMessageSize:       c.String("max.message.size"),
+			OversizeAction:       c.String("oversize.action"),
+			CompressAttachments:  c.String("compress.attachments"),
+			DownloadTimeout:      c.Duration("download.timeout"),
+			DownloadMaxSize:      c.String("download.max.size"),
+			DownloadHeader:       c.String("download.header"),
+			AttachmentsRequired:  c.Bool("attachments.required"),
+			AttachmentTypes:      c.StringSlice("attachment.types"),
+			AttachStdin:          c.String("attach.stdin"),
+			AttachmentChecksums:  c.Bool("attachment.checksums"),
+			AttachmentExtensions: c.StringSlice("attachment.extensions"),
+			BodyEncoding:         c.String("body.encoding"),
+			AttachmentEncoding:   c.String("attachment.encoding"),
+			CustomHeaders:        customHeaders,
+			Priority:             c.StringSlice("priority"),
+			Thread:               c.Bool("thread"),
+			ThreadKey:            c.String("thread.key"),
+			ListID:               c.String("list.id"),
+			ListUnsubscribe:      c.StringSlice("list.unsubscribe"),
+			AutoSubmitted:        c.BoolT("auto.submitted"),
+			DroneHeaders:         c.Bool("drone.headers"),
+			ReadReceipt:          c.StringSlice("read.receipt"),
+			Sender:               c.String("sender"),
+			EnvelopeFrom:         c.String("envelope.from"),
+			MessageIDDomain:      c.String("message.id.domain"),
+			VERP:                 c.String("verp"),
+			SubjectTag:           c.Bool("subject.tag"),
+			ReplyTo:              c.String("reply.to"),
+			SMIMECertificate:     c.String("smime.certificate"),
+			SMIMEKey:             c.String("smime.key"),
+			SMIMEPKCS12:          c.String("smime.pkcs12"),
+			SMIMEPassword:        c.String("smime.password"),
+			PGPKeyring:           c.String("pgp.keyring"),
+			PGPSigningKey:        c.String("pgp.signing.key"),
+			PGPPassphrase:        c.String("pgp.passphrase"),
+			SanitizeHTML:         c.Bool("sanitize.html"),
+			LogRecipients:        c.String("log.recipients"),
+			AuditLog:             c.String("audit.log"),
+			TLSRequired:          c.Bool("tls.required"),
+			Preflight:            c.String("preflight"),
+			DryRun:               c.Bool("dry.run"),
+			OutputDir:            c.String("output.dir"),
+			DebugSMTP:            c.Bool("debug.smtp"),
+			MetricsURL:           c.String("metrics.url"),
+			FailOnPartial:        c.Bool("fail.on.partial"),
+			ReportFile:           c.String("report.file"),
+			CardPath:             c.String("card.path"),
+			OTLPEndpoint:         c.String("otlp.endpoint"),
+			OTLPHeaders:          c.StringSlice("otlp.headers"),
+			CheckOnly:            c.Bool("check.only"),
+			CallbackURL:          c.String("callback.url"),
+			ArchiveURL:           c.String("archive.url"),
+			Timeout:              c.Duration("timeout"),
+			Concurrency:          c.Int("concurrency"),
+			SpoolDir:             c.String("spool.dir"),
+			Aggregate:            c.Bool("aggregate"),
+			AggregateDir:         c.String("aggregate.dir"),
+			AggregateJobs:        c.Int("aggregate.jobs"),
+			AggregateTimeout:     c.Duration("aggregate.timeout"),
+			Digest:               c.String("digest"),
+			DigestDir:            c.String("digest.dir"),
+			IMAPHost:             c.String("imap.host"),
+			IMAPPort:             c.Int("imap.port"),
+			IMAPUsername:         c.String("imap.username"),
+			IMAPPassword:         c.String("imap.password"),
+			IMAPFolder:           c.String("imap.folder"),
+			MailboxPath:          c.String("mailbox.path"),
+			MailboxFormat:        c.String("mailbox.format"),
+			Retries:              c.Int("retries"),
+			RetryBackoff:         c.Duration("retry.backoff"),
+			GreylistWait:         c.Duration("greylist.wait"),
+			Keepalive:            c.Duration("keepalive"),
+			MessagesPerConn:      c.Int("messages.per.connection"),
+			Delivery:             c.String("delivery"),
+			BatchSize:            c.Int("batch.size"),
+			VerifyRecipients:     c.Bool("verify.recipients"),
+			Charset:              c.String("charset"),
+			Force7Bit:            c.Bool("force.7bit"),
 		},
-	}
-
-	return plugin.Exec()
+	}, nil
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/drone-plugins/drone-email/pkg/emailer"
+	"github.com/urfave/cli"
+)
+
+func TestCommandsStart(t *testing.T) {
+	app := newApp()
+	app.Writer = io.Discard
+	app.ErrWriter = io.Discard
+
+	names := []string{""}
+	for _, command := range app.Commands {
+		names = append(names, command.Name)
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("command panicked: %v", r)
+				}
+			}()
+
+			args := []string{"drone-email", "--help"}
+			if name != "" {
+				args = []string{"drone-email", name, "--help"}
+			}
+			if err := app.Run(args); err != nil {
+				t.Fatalf("command failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestPluginSettings(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		check func(c emailer.Config) bool
+	}{
+		{
+			name: "defaults",
+			check: func(c emailer.Config) bool {
+				return c.Format == emailer.FormatMultipart && c.Delivery == emailer.DeliveryIndividual && !c.SanitizeHTML
+			},
+		},
+		{
+			name:  "format",
+			env:   map[string]string{"PLUGIN_FORMAT": "text"},
+			check: func(c emailer.Config) bool { return c.Format == emailer.FormatText },
+		},
+		{
+			name:  "text width",
+			env:   map[string]string{"PLUGIN_TEXT_WIDTH": "72"},
+			check: func(c emailer.Config) bool { return c.TextWidth == 72 },
+		},
+		{
+			name:  "sanitize html",
+			env:   map[string]string{"PLUGIN_SANITIZE_HTML": "true"},
+			check: func(c emailer.Config) bool { return c.SanitizeHTML },
+		},
+		{
+			name:  "keepalive",
+			env:   map[string]string{"PLUGIN_KEEPALIVE": "30s"},
+			check: func(c emailer.Config) bool { return c.Keepalive == 30*time.Second },
+		},
+		{
+			name:  "messages per connection",
+			env:   map[string]string{"PLUGIN_MESSAGES_PER_CONNECTION": "50"},
+			check: func(c emailer.Config) bool { return c.MessagesPerConn == 50 },
+		},
+		{
+			name: "batch delivery",
+			env:  map[string]string{"PLUGIN_DELIVERY": "batch", "PLUGIN_BATCH_SIZE": "20"},
+			check: func(c emailer.Config) bool {
+				return c.Delivery == emailer.DeliveryBatch && c.BatchSize == 20
+			},
+		},
+		{
+			name:  "from address",
+			env:   map[string]string{"PLUGIN_FROM.ADDRESS": "ci@example.com"},
+			check: func(c emailer.Config) bool { return c.FromAddress == "ci@example.com" },
+		},
+		{
+			name: "recipients",
+			env:  map[string]string{"PLUGIN_RECIPIENTS": "jane@example.com,john@example.com"},
+			check: func(c emailer.Config) bool {
+				return slices.Equal(c.Recipients, []string{"jane@example.com", "john@example.com"})
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			var plugin emailer.Plugin
+			app := newApp()
+			app.Action = func(c *cli.Context) error {
+				var err error
+				plugin, err = newPlugin(c)
+				return err
+			}
+			if err := app.Run([]string{"drone-email"}); err != nil {
+				t.Fatalf("app.Run() error = %v", err)
+			}
+			if !test.check(plugin.Config) {
+				t.Errorf("settings %v not applied to %+v", test.env, plugin.Config)
+			}
+		})
+	}
+}
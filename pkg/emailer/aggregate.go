@@ -0,0 +1,179 @@
+package emailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AggregateJob is a job of the build exposed to the templates when the
+// outcomes of all jobs are sent in one email
+type AggregateJob struct {
+	Number   int
+	Name     string
+	Status   string
+	ExitCode int
+	Started  float64
+	Finished float64
+}
+
+// aggregatePollInterval is the interval the API is polled at while waiting
+// for the other jobs
+const aggregatePollInterval = 10 * time.Second
+
+// aggregate collects the outcomes of all jobs of the build. The jobs are
+// only returned to the invocation sending the combined email, for all other
+// invocations ok is false.
+func (p Plugin) aggregate(ctx context.Context) (jobs []AggregateJob, ok bool, err error) {
+	if p.Config.AggregateDir != "" {
+		return p.aggregateFiles()
+	}
+	return p.aggregateAPI(ctx)
+}
+
+// aggregateFiles records the outcome of the job in the state directory
+// shared by all jobs, the job recording the last expected outcome sends
+func (p Plugin) aggregateFiles() ([]AggregateJob, bool, error) {
+	dir := filepath.Join(
+		p.Config.AggregateDir,
+		unsafeFileChars.ReplaceAllString(p.Repo.FullName, "-"),
+		strconv.Itoa(p.Build.Number),
+	)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, false, err
+	}
+
+	status := p.Job.Status
+	if status == "" {
+		status = p.Build.Status
+	}
+	data, err := json.Marshal(AggregateJob{
+		Number:   p.Job.Number,
+		Name:     p.Job.Name,
+		Status:   status,
+		ExitCode: p.Job.ExitCode,
+		Started:  p.Job.Started,
+		Finished: p.Job.Finished,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Rename the written file so other jobs never read a partial outcome
+	name := filepath.Join(dir, fmt.Sprintf("%d.json", p.Job.Number))
+	if err := os.WriteFile(name+".tmp", data, 0o600); err != nil {
+		return nil, false, err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return nil, false, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(files) < p.Config.AggregateJobs {
+		log.Infof("Waiting for %d of %d jobs of build #%d", p.Config.AggregateJobs-len(files), p.Config.AggregateJobs, p.Build.Number)
+		return nil, false, nil
+	}
+
+	// Jobs finishing at the same time may both see all outcomes, only the
+	// one creating the marker sends
+	marker, err := os.OpenFile(filepath.Join(dir, "sent"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		log.Infof("Combined email of build #%d is sent by another job", p.Build.Number)
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	marker.Close()
+
+	jobs := make([]AggregateJob, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, false, err
+		}
+		var job AggregateJob
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, false, fmt.Errorf("could not read outcome %s: %w", file, err)
+		}
+		jobs = append(jobs, job)
+		os.Remove(file)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Number < jobs[j].Number })
+	return jobs, true, nil
+}
+
+// aggregateAPI waits for all other stages of the build to finish, polling
+// the API. The plugin is expected to run in a single stage notifying for all
+// others.
+func (p Plugin) aggregateAPI(ctx context.Context) ([]AggregateJob, bool, error) {
+	timeout := p.Config.AggregateTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client := newAPIClient(ctx, p.Config.APIServer, p.Config.APIToken)
+	for {
+		build, err := client.build(p.Repo.Owner, p.Repo.Name, p.Build.Number)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, false, fmt.Errorf("other jobs of build #%d did not finish within %s", p.Build.Number, timeout)
+			}
+			return nil, false, err
+		}
+
+		jobs := make([]AggregateJob, 0, len(build.Stages))
+		pending := 0
+		for _, stage := range build.Stages {
+			if stage.Number == p.Job.Number {
+				continue
+			}
+			if !finishedStatuses[stage.Status] && stage.Status != "skipped" {
+				pending++
+			}
+			jobs = append(jobs, AggregateJob{
+				Number:   stage.Number,
+				Name:     stage.Name,
+				Status:   stage.Status,
+				ExitCode: stage.ExitCode,
+				Started:  float64(stage.Started),
+				Finished: float64(stage.Finished),
+			})
+		}
+		if pending == 0 {
+			return jobs, true, nil
+		}
+
+		log.Infof("Waiting for %d of %d jobs of build #%d", pending, len(jobs), p.Build.Number)
+		select {
+		case <-ctx.Done():
+			return nil, false, fmt.Errorf("other jobs of build #%d did not finish within %s", p.Build.Number, timeout)
+		case <-time.After(aggregatePollInterval):
+		}
+	}
+}
+
+// aggregateStatus returns the status of the build made of the jobs, failed
+// if any of the jobs failed
+func aggregateStatus(jobs []AggregateJob) string {
+	for _, job := range jobs {
+		switch job.Status {
+		case "failure", "error", "killed":
+			return "failure"
+		}
+	}
+	return "success"
+}
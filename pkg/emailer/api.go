@@ -0,0 +1,124 @@
+package emailer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type (
+	// apiClient is a minimal client for the Drone compatible REST API
+	apiClient struct {
+		ctx    context.Context
+		server string
+		token  string
+		client *http.Client
+	}
+
+	apiBuild struct {
+		Number      int        `json:"number"`
+		Status      string     `json:"status"`
+		Event       string     `json:"event"`
+		Target      string     `json:"target"`
+		After       string     `json:"after"`
+		Message     string     `json:"message"`
+		AuthorLogin string     `json:"author_login"`
+		AuthorName  string     `json:"author_name"`
+		AuthorEmail string     `json:"author_email"`
+		Started     int64      `json:"started"`
+		Finished    int64      `json:"finished"`
+		Stages      []apiStage `json:"stages"`
+	}
+
+	apiStage struct {
+		Number   int       `json:"number"`
+		Name     string    `json:"name"`
+		Status   string    `json:"status"`
+		ExitCode int       `json:"exit_code"`
+		Started  int64     `json:"started"`
+		Finished int64     `json:"stopped"`
+		Steps    []apiStep `json:"steps"`
+	}
+
+	apiStep struct {
+		Number   int    `json:"number"`
+		Name     string `json:"name"`
+		Status   string `json:"status"`
+		ExitCode int    `json:"exit_code"`
+	}
+
+	apiLine struct {
+		Pos  int    `json:"pos"`
+		Out  string `json:"out"`
+		Time int64  `json:"time"`
+	}
+)
+
+func newAPIClient(ctx context.Context, server, token string) *apiClient {
+	return &apiClient{
+		ctx:    ctx,
+		server: strings.TrimRight(server, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// get performs an authenticated GET request and decodes the JSON response
+func (c *apiClient) get(path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, c.server+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s for %s", res.Status, path)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// builds returns the most recent builds of the repository, optionally
+// filtered by branch
+func (c *apiClient) builds(owner, name, branch string, limit int) ([]apiBuild, error) {
+	path := fmt.Sprintf("/api/repos/%s/%s/builds?page=1&per_page=%d", owner, name, limit)
+	if branch != "" {
+		path += "&branch=" + url.QueryEscape(branch)
+	}
+
+	var builds []apiBuild
+	if err := c.get(path, &builds); err != nil {
+		return nil, err
+	}
+	return builds, nil
+}
+
+// build returns a single build including its stages and steps
+func (c *apiClient) build(owner, name string, number int) (*apiBuild, error) {
+	build := new(apiBuild)
+	if err := c.get(fmt.Sprintf("/api/repos/%s/%s/builds/%d", owner, name, number), build); err != nil {
+		return nil, err
+	}
+	return build, nil
+}
+
+// logs returns the log lines of a single step
+func (c *apiClient) logs(owner, name string, build, stage, step int) ([]apiLine, error) {
+	var lines []apiLine
+	if err := c.get(fmt.Sprintf("/api/repos/%s/%s/builds/%d/logs/%d/%d", owner, name, build, stage, step), &lines); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
@@ -0,0 +1,37 @@
+package emailer
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{size: "", want: 0},
+		{size: "512", want: 512},
+		{size: "512B", want: 512},
+		{size: "100KB", want: 100 << 10},
+		{size: "100 kb", want: 100 << 10},
+		{size: "10MB", want: 10 << 20},
+		{size: "10M", want: 10 << 20},
+		{size: "1GiB", want: 1 << 30},
+		{size: "1.5K", want: 1536},
+		{size: " 2KiB ", want: 2 << 10},
+		{size: "ten", wantErr: true},
+		{size: "-1MB", wantErr: true},
+		{size: "MB", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.size, func(t *testing.T) {
+			got, err := parseSize(test.size)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseSize(%q) error = %v, want error %v", test.size, err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("parseSize(%q) = %d, want %d", test.size, got, test.want)
+			}
+		})
+	}
+}
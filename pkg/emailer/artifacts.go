@@ -0,0 +1,86 @@
+package emailer
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ArtifactLink is a named download link exposed to the templates
+type ArtifactLink struct {
+	Name string `json:"name"`
+	URL  string `json:"url" handlebars:"url"`
+}
+
+// artifactLinks returns the configured artifact links with the name and URL
+// rendered against the template context, followed by the links read from the
+// artifact links file
+func (p Plugin) artifactLinks(ctx interface{}) []ArtifactLink {
+	var links []ArtifactLink
+
+	for _, entry := range p.Config.ArtifactLinks {
+		name, url, ok := strings.Cut(entry, "=")
+		if !ok {
+			log.Warnf("Skipping artifact link %q, expected name=url", entry)
+			continue
+		}
+
+		link, err := renderArtifactLink(ArtifactLink{Name: name, URL: url}, ctx)
+		if err != nil {
+			log.Warnf("Could not render artifact link %q: %v", entry, err)
+			continue
+		}
+		links = append(links, link)
+	}
+
+	if p.Config.ArtifactLinksFile != "" {
+		fileLinks, err := readArtifactLinks(p.Config.ArtifactLinksFile)
+		if err != nil {
+			log.Warnf("Could not read artifact links file %s: %v", p.Config.ArtifactLinksFile, err)
+		}
+		links = append(links, fileLinks...)
+	}
+
+	return links
+}
+
+func renderArtifactLink(link ArtifactLink, ctx interface{}) (ArtifactLink, error) {
+	name, err := renderInline(link.Name, ctx)
+	if err != nil {
+		return link, err
+	}
+	url, err := renderInline(link.URL, ctx)
+	if err != nil {
+		return link, err
+	}
+	return ArtifactLink{Name: name, URL: url}, nil
+}
+
+// readArtifactLinks reads a JSON file containing either a list of objects
+// with name and url or an object mapping names to URLs
+func readArtifactLinks(path string) ([]ArtifactLink, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []ArtifactLink
+	if err := json.Unmarshal(data, &links); err == nil {
+		return links, nil
+	}
+
+	var named map[string]string
+	if err := json.Unmarshal(data, &named); err != nil {
+		return nil, err
+	}
+	for name, url := range named {
+		links = append(links, ArtifactLink{Name: name, URL: url})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Name < links[j].Name
+	})
+	return links, nil
+}
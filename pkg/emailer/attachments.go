@@ -0,0 +1,532 @@
+package emailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	mail "github.com/wneessen/go-mail"
+)
+
+// Compression modes for attachments
+const (
+	CompressNone = "none"
+	CompressGzip = "gzip"
+	CompressZip  = "zip"
+)
+
+// compressedExtensions are not compressed again
+var compressedExtensions = map[string]bool{
+	".gz": true, ".tgz": true, ".zip": true, ".bz2": true, ".xz": true,
+	".zst": true, ".7z": true, ".rar": true, ".jar": true, ".war": true,
+}
+
+// compressedTypes are not compressed again
+var compressedTypes = map[string]bool{
+	"application/gzip": true, "application/x-gzip": true, "application/zip": true,
+	"application/x-bzip2": true, "application/x-xz": true, "application/zstd": true,
+	"application/x-7z-compressed": true, "application/vnd.rar": true,
+	"application/x-rar-compressed": true, "application/java-archive": true,
+}
+
+// blockedExtensions are quarantined by most mail gateways and not attached
+// unless explicitly allowed
+var blockedExtensions = map[string]bool{
+	".exe": true, ".com": true, ".bat": true, ".cmd": true, ".cpl": true,
+	".scr": true, ".pif": true, ".msi": true, ".msp": true, ".dll": true,
+	".vbs": true, ".vbe": true, ".js": true, ".jse": true, ".wsf": true,
+	".wsh": true, ".ps1": true, ".hta": true, ".lnk": true, ".reg": true,
+}
+
+// inlinePrefix marks attachment entries which are embedded inline
+const inlinePrefix = "inline:"
+
+// Actions for attachments exceeding the configured size limits
+const (
+	OversizeSkip = "skip"
+	OversizeFail = "fail"
+)
+
+// attachment is a file attached to the message, either read from Path or
+// generated at runtime and attached from memory. Inline attachments are
+// embedded and referenced via cid:Name.
+type attachment struct {
+	Name        string
+	Path        string
+	Data        []byte
+	Inline      bool
+	ContentType mail.ContentType
+
+	fileSize int64
+}
+
+// fileAttachment returns an attachment for the file at path
+func fileAttachment(path string, inline bool) (attachment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return attachment{}, err
+	}
+	if info.IsDir() {
+		return attachment{}, fmt.Errorf("%s is a directory", path)
+	}
+
+	// named pipes and devices can only be read once, keep their content
+	if !info.Mode().IsRegular() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return attachment{}, err
+		}
+		return attachment{
+			Name:   filepath.Base(path),
+			Data:   data,
+			Inline: inline,
+		}, nil
+	}
+
+	return attachment{
+		Name:     filepath.Base(path),
+		Path:     path,
+		Inline:   inline,
+		fileSize: info.Size(),
+	}, nil
+}
+
+// fileAttachments expands the configured attachment entries. Each entry is a
+// path, glob pattern or http(s) URL, optionally followed by =name to rename
+// the attached file. Entries are rendered against the template context.
+// Entries prefixed with inline: are embedded instead of attached.
+// Missing files and failed downloads are skipped unless attachments are
+// required.
+func (p Plugin) fileAttachments(ctx context.Context, data interface{}) ([]attachment, error) {
+	var attachments []attachment
+	var missing []string
+	seen := make(map[string]struct{})
+
+	for _, entry := range append([]string{p.Config.Attachment}, p.Config.Attachments...) {
+		entry = strings.TrimSpace(entry)
+
+		// inline: embeds the files to be referenced via cid:name
+		inline := strings.HasPrefix(entry, inlinePrefix)
+		entry = strings.TrimPrefix(entry, inlinePrefix)
+
+		entry, err := renderInline(entry, data)
+		if err != nil {
+			return nil, err
+		}
+		pattern, name := splitRename(entry)
+		if pattern == "" {
+			continue
+		}
+
+		if isURL(pattern) {
+			a, err := p.downloadAttachment(ctx, pattern)
+			if err != nil {
+				log.Warnf("Could not download attachment %s: %v", pattern, err)
+				missing = append(missing, pattern)
+				continue
+			}
+			if name != "" {
+				a.Name = name
+			}
+			a.Inline = inline
+			if !p.allowedExtension(a.Name) {
+				log.Warnf("Not attaching %s as its extension is not allowed", a.Name)
+				continue
+			}
+			attachments = append(attachments, a)
+			continue
+		}
+
+		files, err := expandGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			missing = append(missing, pattern)
+		}
+
+		if name != "" {
+			if len(files) > 1 {
+				log.Warnf("Not renaming attachments to %s as %s matches %d files", name, pattern, len(files))
+				name = ""
+			}
+		}
+
+		for _, file := range files {
+			if _, ok := seen[file]; ok {
+				continue
+			}
+			seen[file] = struct{}{}
+
+			a, err := fileAttachment(file, inline)
+			if err != nil {
+				missing = append(missing, file)
+				continue
+			}
+			if name != "" {
+				a.Name = name
+			}
+			if !p.allowedExtension(a.Name) {
+				log.Warnf("Not attaching %s as its extension is not allowed", a.Name)
+				continue
+			}
+			attachments = append(attachments, a)
+		}
+	}
+
+	if len(missing) > 0 && p.Config.AttachmentsRequired {
+		return nil, fmt.Errorf("missing attachments: %s", strings.Join(missing, ", "))
+	}
+
+	return attachments, nil
+}
+
+// splitRename splits the =name suffix renaming the attachment off the entry.
+// In URLs with a query the name follows the last complete parameter, so
+// https://example.com/report?id=1=report.pdf is renamed to report.pdf while
+// https://example.com/report?id=1 keeps its name.
+func splitRename(entry string) (target, name string) {
+	if !isURL(entry) || !strings.Contains(entry, "?") {
+		target, name, _ = strings.Cut(entry, "=")
+		return target, name
+	}
+
+	i := strings.LastIndex(entry, "=")
+	if i < 0 {
+		return entry, ""
+	}
+	_, query, _ := strings.Cut(entry[:i], "?")
+	for _, param := range strings.Split(query, "&") {
+		if !strings.Contains(param, "=") {
+			return entry, ""
+		}
+	}
+	return entry[:i], entry[i+1:]
+}
+
+// allowedExtension reports whether a file with the given name may be
+// attached. With configured attachment extensions only those are allowed,
+// otherwise all but the blocked extensions are.
+func (p Plugin) allowedExtension(name string) bool {
+	name = strings.ToLower(name)
+	if len(p.Config.AttachmentExtensions) == 0 {
+		return !blockedExtensions[filepath.Ext(name)]
+	}
+
+	for _, allowed := range p.Config.AttachmentExtensions {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		switch {
+		case allowed == "*":
+			return true
+		case allowed == "":
+			if filepath.Ext(name) == "" {
+				return true
+			}
+		case strings.HasSuffix(name, "."+strings.TrimPrefix(allowed, ".")):
+			return true
+		}
+	}
+	return false
+}
+
+// stdinAttachment returns an attachment with the given name holding the
+// content piped to the plugin
+func stdinAttachment(name string) (*attachment, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeCharDevice != 0 {
+		return nil, fmt.Errorf("stdin is a terminal")
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachment{
+		Name: name,
+		Data: data,
+	}, nil
+}
+
+// size returns the size of the attachment in bytes
+func (a attachment) size() int64 {
+	if a.Path != "" {
+		return a.fileSize
+	}
+	return int64(len(a.Data))
+}
+
+// content returns the data of the attachment, reading it from disk if needed
+func (a attachment) content() ([]byte, error) {
+	if a.Path != "" {
+		return os.ReadFile(a.Path)
+	}
+	return a.Data, nil
+}
+
+// compressible reports whether the attachment may be compressed. Inline
+// attachments, attachments with an explicit content type and archives are
+// kept as is. The configured content type overrides take precedence over the
+// file extension.
+func (p Plugin) compressible(a attachment) bool {
+	if a.Inline || a.ContentType != "" {
+		return false
+	}
+	if contentType := p.contentTypeFor(a.Name); contentType != "" {
+		mediaType, _, _ := strings.Cut(string(contentType), ";")
+		return !compressedTypes[strings.ToLower(strings.TrimSpace(mediaType))]
+	}
+	return !compressedExtensions[strings.ToLower(filepath.Ext(a.Name))]
+}
+
+// compressAttachments compresses the attachments either individually with
+// gzip or bundled into a single zip archive
+func (p Plugin) compressAttachments(attachments []attachment) ([]attachment, error) {
+	switch p.Config.CompressAttachments {
+	case "", CompressNone:
+		return attachments, nil
+	case CompressGzip, CompressZip:
+	default:
+		return nil, fmt.Errorf("unknown attachment compression %q", p.Config.CompressAttachments)
+	}
+
+	var result, bundle []attachment
+	for _, a := range attachments {
+		if !p.compressible(a) {
+			result = append(result, a)
+			continue
+		}
+
+		if p.Config.CompressAttachments == CompressZip {
+			bundle = append(bundle, a)
+			continue
+		}
+
+		data, err := a.content()
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := gzipBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, attachment{Name: a.Name + ".gz", Data: compressed})
+	}
+
+	if len(bundle) > 0 {
+		data, err := zipAttachments(bundle)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, attachment{Name: "attachments.zip", Data: data})
+	}
+
+	return result, nil
+}
+
+// applyContentTypes overrides the content type of attachments whose name
+// matches the pattern of a pattern=type entry, the first match wins
+func (p Plugin) applyContentTypes(attachments []attachment) ([]attachment, error) {
+	for _, entry := range p.Config.AttachmentTypes {
+		pattern, _, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid attachment type %q, expected pattern=type", entry)
+		}
+		if _, err := filepath.Match(strings.TrimSpace(pattern), ""); err != nil {
+			return nil, fmt.Errorf("invalid attachment type pattern %q: %w", pattern, err)
+		}
+	}
+
+	for i, a := range attachments {
+		if a.Inline || a.ContentType != "" {
+			continue
+		}
+		attachments[i].ContentType = p.contentTypeFor(a.Name)
+	}
+
+	return attachments, nil
+}
+
+// contentTypeFor returns the content type of the first pattern=type entry
+// matching the name, or an empty type if none matches
+func (p Plugin) contentTypeFor(name string) mail.ContentType {
+	for _, entry := range p.Config.AttachmentTypes {
+		pattern, contentType, _ := strings.Cut(entry, "=")
+		if ok, _ := filepath.Match(strings.TrimSpace(pattern), name); ok {
+			return mail.ContentType(strings.TrimSpace(contentType))
+		}
+	}
+	return ""
+}
+
+// attachTo adds the attachment to the message with the given transfer
+// encoding
+func (a attachment) attachTo(msg *mail.Msg, encoding mail.Encoding) error {
+	opts := []mail.FileOption{mail.WithFileName(a.Name), mail.WithFileEncoding(encoding)}
+	if a.ContentType != "" {
+		opts = append(opts, mail.WithFileContentType(a.ContentType))
+	}
+
+	switch {
+	case a.Path != "" && a.Inline:
+		msg.EmbedFile(a.Path, opts...)
+	case a.Path != "":
+		msg.AttachFile(a.Path, opts...)
+	case a.Inline:
+		return msg.EmbedReader(a.Name, bytes.NewReader(a.Data), opts...)
+	default:
+		return msg.AttachReader(a.Name, bytes.NewReader(a.Data), opts...)
+	}
+	return nil
+}
+
+// limitAttachments enforces the configured attachment and message size
+// limits. Attachments exceeding the attachment size limit are skipped, then
+// the largest attachments are dropped until the message measured by the
+// given function fits the message size limit. Skipped attachments are
+// returned separately or fail the step. Inline attachments are referenced by
+// the body and are never skipped.
+func (p Plugin) limitAttachments(attachments []attachment, measure func(kept, skipped []attachment) (int64, error)) ([]attachment, []attachment, error) {
+	maxAttachment, err := parseSize(p.Config.MaxAttachmentSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	maxMessage, err := parseSize(p.Config.MaxMessageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var kept, skipped []attachment
+	for _, a := range attachments {
+		if !a.Inline && maxAttachment > 0 && a.size() > maxAttachment {
+			skipped = append(skipped, a)
+			continue
+		}
+		kept = append(kept, a)
+	}
+
+	for maxMessage > 0 {
+		size, err := measure(kept, skipped)
+		if err != nil {
+			return nil, nil, err
+		}
+		if size <= maxMessage {
+			break
+		}
+
+		largest := -1
+		for i, a := range kept {
+			if !a.Inline && (largest < 0 || a.size() > kept[largest].size()) {
+				largest = i
+			}
+		}
+		if largest < 0 {
+			log.Warnf("Message size of %d bytes exceeds the maximum of %d bytes without attachments", size, maxMessage)
+			break
+		}
+
+		skipped = append(skipped, kept[largest])
+		kept = append(kept[:largest:largest], kept[largest+1:]...)
+	}
+
+	if len(skipped) > 0 && p.Config.OversizeAction == OversizeFail {
+		names := make([]string, 0, len(skipped))
+		for _, a := range skipped {
+			names = append(names, fmt.Sprintf("%s (%d bytes)", a.Name, a.size()))
+		}
+		return nil, nil, fmt.Errorf("attachments exceed the size limits: %s", strings.Join(names, ", "))
+	}
+
+	return kept, skipped, nil
+}
+
+// skippedNote returns the note about skipped attachments added to the HTML
+// and plain text body
+func skippedNote(skipped []attachment) (string, string) {
+	var htmlNote, textNote strings.Builder
+
+	htmlNote.WriteString(`<p>The following attachments were skipped as they exceed the size limits:</p><ul>`)
+	textNote.WriteString("The following attachments were skipped as they exceed the size limits:\n")
+	for _, a := range skipped {
+		fmt.Fprintf(&htmlNote, "<li>%s (%d bytes)</li>", html.EscapeString(a.Name), a.size())
+		fmt.Fprintf(&textNote, "* %s (%d bytes)\n", a.Name, a.size())
+	}
+	htmlNote.WriteString("</ul>")
+
+	return htmlNote.String(), textNote.String()
+}
+
+// checksumNote returns a table of the names, sizes and SHA-256 sums of the
+// attachments added to the HTML and plain text body. Inline attachments are
+// part of the body and not listed.
+func checksumNote(attachments []attachment) (string, string, error) {
+	var htmlNote, textNote strings.Builder
+
+	htmlNote.WriteString(`<table class="checksums"><tr><th>Attachment</th><th>Size</th><th>SHA-256</th></tr>`)
+	textNote.WriteString("Attachment checksums (SHA-256):\n")
+	for _, a := range attachments {
+		if a.Inline {
+			continue
+		}
+
+		data, err := a.content()
+		if err != nil {
+			return "", "", err
+		}
+		sum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+		fmt.Fprintf(&htmlNote, "<tr><td>%s</td><td>%d bytes</td><td><code>%s</code></td></tr>", html.EscapeString(a.Name), a.size(), sum)
+		fmt.Fprintf(&textNote, "%s  %s (%d bytes)\n", sum, a.Name, a.size())
+	}
+	htmlNote.WriteString("</table>")
+
+	return htmlNote.String(), textNote.String(), nil
+}
+
+// dirAttachment zips the configured directory into an attachment, honoring
+// the configured maximum archive size
+func (p Plugin) dirAttachment(ctx interface{}) (*attachment, error) {
+	dir, err := renderInline(p.Config.AttachDir, ctx)
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Clean(dir)
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is no directory", dir)
+	}
+
+	data, err := zipDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSize, err := parseSize(p.Config.AttachDirMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("archive of %s is %d bytes, exceeding the maximum of %d bytes", dir, len(data), maxSize)
+	}
+
+	name := filepath.Base(dir)
+	if name == "." || name == string(filepath.Separator) {
+		name = "attachments"
+	}
+
+	return &attachment{Name: name + ".zip", Data: data}, nil
+}
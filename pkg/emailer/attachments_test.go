@@ -0,0 +1,180 @@
+package emailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestTemplatedAttachmentPaths(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "reports", "fix&<b>")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "junit.xml"), []byte("<testsuites/>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := map[string]interface{}{
+		"commit": map[string]interface{}{"branch": "fix&<b>"},
+		"build":  map[string]interface{}{"number": 42},
+	}
+
+	t.Run("attachment", func(t *testing.T) {
+		p := Plugin{Config: Config{
+			Attachments:         []string{root + "/reports/{{ commit.branch }}/junit.xml=junit-{{ build.number }}&{{ commit.branch }}.xml"},
+			AttachmentsRequired: true,
+		}}
+		attachments, err := p.fileAttachments(context.Background(), ctx)
+		if err != nil {
+			t.Fatalf("fileAttachments() error = %v", err)
+		}
+		if len(attachments) != 1 || attachments[0].Name != "junit-42&fix&<b>.xml" {
+			t.Errorf("fileAttachments() = %+v, want junit-42&fix&<b>.xml", attachments)
+		}
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		p := Plugin{Config: Config{AttachDir: root + "/reports/{{ commit.branch }}"}}
+		a, err := p.dirAttachment(ctx)
+		if err != nil {
+			t.Fatalf("dirAttachment() error = %v", err)
+		}
+		if a.Name != "fix&<b>.zip" {
+			t.Errorf("dirAttachment() name = %q, want %q", a.Name, "fix&<b>.zip")
+		}
+	})
+}
+
+func TestLimitAttachments(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		attachments []attachment
+		kept        []string
+		skipped     []string
+		wantErr     bool
+	}{
+		{
+			name:        "no limits",
+			attachments: []attachment{{Name: "a.log", Data: make([]byte, 300)}, {Name: "b.log", Data: make([]byte, 500)}},
+			kept:        []string{"a.log", "b.log"},
+		},
+		{
+			name:        "attachment limit",
+			config:      Config{MaxAttachmentSize: "400"},
+			attachments: []attachment{{Name: "a.log", Data: make([]byte, 300)}, {Name: "b.log", Data: make([]byte, 500)}},
+			kept:        []string{"a.log"},
+			skipped:     []string{"b.log"},
+		},
+		{
+			name:        "message limit skips the largest first",
+			config:      Config{MaxMessageSize: "1000"},
+			attachments: []attachment{{Name: "a.log", Data: make([]byte, 300)}, {Name: "b.log", Data: make([]byte, 500)}, {Name: "c.log", Data: make([]byte, 400)}},
+			kept:        []string{"a.log", "c.log"},
+			skipped:     []string{"b.log"},
+		},
+		{
+			name:        "inline attachments kept",
+			config:      Config{MaxAttachmentSize: "100", MaxMessageSize: "500"},
+			attachments: []attachment{{Name: "logo.png", Data: make([]byte, 600), Inline: true}, {Name: "a.log", Data: make([]byte, 50)}},
+			kept:        []string{"logo.png"},
+			skipped:     []string{"a.log"},
+		},
+		{
+			name:        "oversize fail",
+			config:      Config{MaxAttachmentSize: "400", OversizeAction: OversizeFail},
+			attachments: []attachment{{Name: "a.log", Data: make([]byte, 300)}, {Name: "b.log", Data: make([]byte, 500)}},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid size",
+			config:      Config{MaxMessageSize: "ten"},
+			attachments: []attachment{{Name: "a.log", Data: make([]byte, 300)}},
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The message measures 100 bytes plus its attachments
+			measure := func(kept, skipped []attachment) (int64, error) {
+				size := int64(100)
+				for _, a := range kept {
+					size += a.size()
+				}
+				return size, nil
+			}
+
+			kept, skipped, err := Plugin{Config: test.config}.limitAttachments(test.attachments, measure)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("limitAttachments() error = %v, want error %v", err, test.wantErr)
+			}
+			var keptNames, skippedNames []string
+			for _, a := range kept {
+				keptNames = append(keptNames, a.Name)
+			}
+			for _, a := range skipped {
+				skippedNames = append(skippedNames, a.Name)
+			}
+			if !slices.Equal(keptNames, test.kept) {
+				t.Errorf("limitAttachments() kept = %q, want %q", keptNames, test.kept)
+			}
+			if !slices.Equal(skippedNames, test.skipped) {
+				t.Errorf("limitAttachments() skipped = %q, want %q", skippedNames, test.skipped)
+			}
+		})
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	p := Plugin{Config: Config{AttachmentTypes: []string{"*.dat=application/gzip", "*.bin=text/plain; charset=utf-8"}}}
+
+	tests := []struct {
+		attachment attachment
+		want       bool
+	}{
+		{attachment: attachment{Name: "build.log"}, want: true},
+		{attachment: attachment{Name: "dist.tar.gz"}, want: false},
+		{attachment: attachment{Name: "dist.ZIP"}, want: false},
+		{attachment: attachment{Name: "logo.png", Inline: true}, want: false},
+		{attachment: attachment{Name: "invite.ics", ContentType: "text/calendar"}, want: false},
+		{attachment: attachment{Name: "cache.dat"}, want: false},
+		{attachment: attachment{Name: "dump.bin"}, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.attachment.Name, func(t *testing.T) {
+			if got := p.compressible(test.attachment); got != test.want {
+				t.Errorf("compressible() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSplitRename(t *testing.T) {
+	tests := []struct {
+		entry  string
+		target string
+		name   string
+	}{
+		{entry: "dist/report.html", target: "dist/report.html"},
+		{entry: "dist/report.html=report-42.html", target: "dist/report.html", name: "report-42.html"},
+		{entry: "https://example.com/report.pdf", target: "https://example.com/report.pdf"},
+		{entry: "https://example.com/report?id=1", target: "https://example.com/report?id=1"},
+		{entry: "https://example.com/report?id=1=report.pdf", target: "https://example.com/report?id=1", name: "report.pdf"},
+		{entry: "https://example.com/report?id=1&raw=report.pdf", target: "https://example.com/report?id=1&raw=report.pdf"},
+		{entry: "https://example.com/report?raw=report.pdf", target: "https://example.com/report?raw=report.pdf"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.entry, func(t *testing.T) {
+			target, name := splitRename(test.entry)
+			if target != test.target || name != test.name {
+				t.Errorf("splitRename() = %q, %q, want %q, %q", target, name, test.target, test.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package emailer
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	mail "github.com/wneessen/go-mail"
+)
+
+type (
+	// auditLog appends a JSON line per sent message to the audit log file
+	auditLog struct {
+		file  *os.File
+		repo  string
+		build int
+	}
+
+	auditEntry struct {
+		Time       time.Time `json:"time"`
+		Repo       string    `json:"repo"`
+		Build      int       `json:"build"`
+		Recipients []string  `json:"recipients"`
+		Subject    string    `json:"subject_sha256"`
+		MessageID  string    `json:"message_id"`
+		Delivered  bool      `json:"delivered"`
+		Response   string    `json:"response,omitempty"`
+		Error      string    `json:"error,omitempty"`
+	}
+)
+
+// openAuditLog opens the configured audit log for appending. It returns nil
+// if no audit log is configured.
+func (p Plugin) openAuditLog() (*auditLog, error) {
+	if p.Config.AuditLog == "" {
+		return nil, nil
+	}
+
+	file, err := os.OpenFile(p.Config.AuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{
+		file:  file,
+		repo:  p.Repo.FullName,
+		build: p.Build.Number,
+	}, nil
+}
+
+// record appends the outcome of sending the message to the recipient. The
+// subject is recorded as hash only.
+func (a *auditLog) record(msg *mail.Msg, recipient, subject string, sendErr error) {
+	if a == nil {
+		return
+	}
+
+	entry := auditEntry{
+		Time:       time.Now().UTC(),
+		Repo:       a.repo,
+		Build:      a.build,
+		Recipients: []string{recipient},
+		Subject:    fmt.Sprintf("%x", sha256.Sum256([]byte(subject))),
+		MessageID:  msg.GetMessageID(),
+		Delivered:  sendErr == nil,
+		Response:   msg.ServerResponse(),
+	}
+	if sendErr != nil {
+		entry.Error = sendErr.Error()
+	}
+
+	encoder := json.NewEncoder(a.file)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(entry); err != nil {
+		log.Warnf("Could not write audit log: %v", err)
+	}
+}
+
+// Close closes the audit log file
+func (a *auditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	return a.file.Close()
+}
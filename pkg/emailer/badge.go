@@ -0,0 +1,114 @@
+package emailer
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	badgeLabel   = "build"
+	badgeHeight  = 20
+	badgePadding = 6
+)
+
+var (
+	badgeLabelColor   = color.RGBA{0x55, 0x55, 0x55, 0xff}
+	badgeSuccessColor = color.RGBA{0x68, 0xb9, 0x0f, 0xff}
+	badgeFailureColor = color.RGBA{0xd0, 0x02, 0x1b, 0xff}
+	badgeOtherColor   = color.RGBA{0xff, 0x9f, 0x00, 0xff}
+)
+
+// badge returns the status badge embedded into the message, either fetched
+// from the configured badge URL or generated from the build status
+func (p Plugin) badge(ctx interface{}) (*attachment, error) {
+	if p.Config.BadgeURL == "" {
+		data, err := generateBadge(p.Build.Status)
+		if err != nil {
+			return nil, err
+		}
+		return &attachment{Name: "badge.png", Data: data, Inline: true}, nil
+	}
+
+	url, err := renderInline(p.Config.BadgeURL, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s fetching badge", res.Status)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	name := "badge.png"
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	switch mediaType {
+	case "image/svg+xml":
+		name = "badge.svg"
+	case "image/gif":
+		name = "badge.gif"
+	case "image/jpeg":
+		name = "badge.jpg"
+	}
+
+	return &attachment{Name: name, Data: data, Inline: true}, nil
+}
+
+// generateBadge draws a shields style PNG badge for the build status
+func generateBadge(status string) ([]byte, error) {
+	text, background := status, badgeOtherColor
+	switch status {
+	case "success":
+		text, background = "passing", badgeSuccessColor
+	case "failure", "error", "killed":
+		text, background = "failing", badgeFailureColor
+	}
+
+	face := basicfont.Face7x13
+	labelWidth := font.MeasureString(face, badgeLabel).Ceil() + 2*badgePadding
+	textWidth := font.MeasureString(face, text).Ceil() + 2*badgePadding
+
+	img := image.NewRGBA(image.Rect(0, 0, labelWidth+textWidth, badgeHeight))
+	draw.Draw(img, image.Rect(0, 0, labelWidth, badgeHeight), image.NewUniform(badgeLabelColor), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(labelWidth, 0, labelWidth+textWidth, badgeHeight), image.NewUniform(background), image.Point{}, draw.Src)
+
+	drawer := &font.Drawer{
+		Dst:  img,
+		Src:  image.White,
+		Face: face,
+	}
+	baseline := (badgeHeight + face.Ascent - face.Descent) / 2
+
+	drawer.Dot = fixed.P(badgePadding, baseline)
+	drawer.DrawString(badgeLabel)
+	drawer.Dot = fixed.P(labelWidth+badgePadding, baseline)
+	drawer.DrawString(text)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
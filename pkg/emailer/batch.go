@@ -0,0 +1,286 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	netmail "net/mail"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	mail "github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail/smtp"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Strategies delivering the messages
+const (
+	DeliveryIndividual = "individual"
+	DeliveryBatch      = "batch"
+)
+
+// defaultBatchSize is the number of recipients of a single message, which
+// RFC 5321 requires servers to accept
+const defaultBatchSize = 100
+
+// rcptMax matches the recipient limit advertised by the LIMITS extension
+var rcptMax = regexp.MustCompile(`(?i)\bRCPTMAX=(\d+)`)
+
+// pathAddress returns the plain address of the recipient in angle brackets
+// as used by the MAIL and RCPT commands
+func pathAddress(recipient string) string {
+	if parsed, err := netmail.ParseAddress(recipient); err == nil {
+		recipient = parsed.Address
+	}
+	return "<" + recipient + ">"
+}
+
+// batchSize returns the number of recipients per message, the configured
+// size lowered to the limit the server advertises
+func (p Plugin) batchSize(client *smtp.Client) int {
+	size := p.Config.BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	if ok, params := client.Extension("LIMITS"); ok {
+		if match := rcptMax.FindStringSubmatch(params); match != nil {
+			if limit, _ := strconv.Atoi(match[1]); limit > 0 {
+				size = min(size, limit)
+			}
+		}
+	}
+	return size
+}
+
+// deliverBatches sends a single message to many recipients at once instead
+// of uploading it for every recipient. The recipients with personalized
+// content and those failing temporarily are returned, to be delivered
+// individually with retries and spooling.
+func (p Plugin) deliverBatches(ctx context.Context, timing *timings, recipients map[string]struct{}, content message, d *delivery) map[string]struct{} {
+	pending := make(map[string]struct{})
+	var shared []string
+	for _, recipient := range slices.Sorted(maps.Keys(recipients)) {
+		if _, ok := content.Personalized[recipient]; ok {
+			pending[recipient] = struct{}{}
+		} else {
+			shared = append(shared, recipient)
+		}
+	}
+	if len(shared) < 2 {
+		return recipients
+	}
+
+	client, err := p.newClient()
+	if err != nil {
+		log.Warnf("Could not create mail client for batches, sending individually: %v", err)
+		return recipients
+	}
+	smtpClient, err := client.DialToSMTPClientWithContext(ctx)
+	if err != nil {
+		log.Warnf("Could not connect to send batches, sending individually: %v", err)
+		return recipients
+	}
+	defer func() {
+		client.CloseWithSMTPClient(smtpClient)
+	}()
+
+	size := p.batchSize(smtpClient)
+	for sent := 0; len(shared) > 0 && ctx.Err() == nil && !d.aborted(); sent++ {
+		// Reconnect once the messages per connection are sent
+		if limit := p.Config.MessagesPerConn; limit > 0 && sent > 0 && sent%limit == 0 {
+			client.CloseWithSMTPClient(smtpClient)
+			if smtpClient, err = client.DialToSMTPClientWithContext(ctx); err != nil {
+				log.Warnf("Could not reconnect to send batches, sending individually: %v", err)
+				break
+			}
+		}
+
+		batch := shared[:min(size, len(shared))]
+		shared = shared[len(batch):]
+
+		_, phase := timing.start(ctx, "send batch", attribute.Int("recipients", len(batch)))
+		deferred, failed, err := p.sendBatch(ctx, smtpClient, batch, content, d)
+		phase.end(err)
+
+		// Servers limiting the recipients reply 452 to the excess ones,
+		// which are sent with the next message
+		if len(deferred) > 0 {
+			size = len(batch) - len(deferred)
+			shared = append(deferred, shared...)
+		}
+		for _, recipient := range failed {
+			pending[recipient] = struct{}{}
+		}
+
+		// The connection is unusable after losing it
+		if err != nil {
+			log.Warnf("Could not send batch, sending individually: %v", err)
+			break
+		}
+	}
+	for _, recipient := range shared {
+		pending[recipient] = struct{}{}
+	}
+	return pending
+}
+
+// sendBatch sends the message to the recipients in a single transaction and
+// records the results. It returns the recipients exceeding the limit of the
+// server and the recipients failing temporarily.
+func (p Plugin) sendBatch(ctx context.Context, client *smtp.Client, recipients []string, content message, d *delivery) (deferred, failed []string, err error) {
+	started := time.Now()
+
+	msg, err := p.newMessage(recipients[0], content)
+	if err != nil {
+		return nil, recipients, err
+	}
+	// Keep the recipients undisclosed, addressing the message to the sender
+	if err := msg.To(p.Config.FromAddress); err != nil {
+		return nil, recipients, err
+	}
+	from, err := msg.GetSender(false)
+	if err != nil {
+		return nil, recipients, err
+	}
+
+	replies, err := transaction(client, from, recipients)
+	if err != nil {
+		return nil, recipients, err
+	}
+
+	results := make(map[string]error)
+	var accepted []string
+	for i, recipient := range recipients {
+		switch reply := replies[i]; {
+		case reply == nil:
+			accepted = append(accepted, recipient)
+		case replyCode(reply) == 452 && len(accepted) > 0:
+			deferred = append(deferred, recipient)
+		case retryable(reply):
+			log.Warnf("Temporary failure adding %q to the batch, sending individually: %v", p.logRecipient(recipient), reply)
+			failed = append(failed, recipient)
+		default:
+			results[recipient] = reply
+		}
+	}
+
+	if len(accepted) == 0 {
+		if err := client.Reset(); err != nil {
+			return deferred, failed, err
+		}
+	} else {
+		sendErr := data(client, msg)
+		switch {
+		case sendErr == nil:
+		case retryable(sendErr):
+			log.Warnf("Temporary failure sending batch, sending individually: %v", sendErr)
+			failed = append(failed, accepted...)
+			accepted = nil
+			if replyCode(sendErr) == 0 {
+				err = sendErr
+			}
+		}
+		for _, recipient := range accepted {
+			results[recipient] = sendErr
+		}
+	}
+
+	d.mu.Lock()
+	for _, recipient := range recipients {
+		sendErr, ok := results[recipient]
+		if !ok {
+			continue
+		}
+		d.audit.record(msg, recipient, content.Subject, sendErr)
+		d.report.add(p.logRecipient(recipient), msg, time.Since(started), 1, sendErr)
+		if sendErr != nil {
+			d.failed++
+		} else {
+			d.metrics.Sent++
+		}
+	}
+	d.metrics.Latency += time.Since(started)
+	d.mu.Unlock()
+
+	for _, recipient := range recipients {
+		sendErr, ok := results[recipient]
+		switch {
+		case !ok:
+		case sendErr != nil:
+			log.Errorf("Could not send email to %q: %v", p.logRecipient(recipient), sendErr)
+		default:
+			log.Infof("Sent email to %q", p.logRecipient(recipient))
+		}
+	}
+	if len(accepted) == 0 || results[accepted[0]] != nil {
+		return deferred, failed, err
+	}
+
+	// Keep a single copy of the message shared by the recipients
+	if err := d.archive.upload(ctx, accepted[0], msg); err != nil {
+		log.Errorf("Could not archive batch: %v", err)
+		d.mu.Lock()
+		d.unarchived++
+		d.mu.Unlock()
+	}
+	if err := d.mailbox.write(msg); err != nil {
+		log.Errorf("Could not write batch to the mailbox: %v", err)
+		d.mu.Lock()
+		d.unarchived++
+		d.mu.Unlock()
+	}
+	if err := d.sent.append(msg); err != nil {
+		log.Warnf("Could not copy batch to the IMAP folder: %v", err)
+	}
+	return deferred, failed, err
+}
+
+// transaction starts a mail transaction for the recipients and returns the
+// reply to the RCPT command of every recipient. The MAIL command is sent by
+// the client, so its parameters are the same with and without pipelining.
+// The RCPT commands are sent at once without waiting for the replies if the
+// server supports PIPELINING.
+func transaction(client *smtp.Client, from string, recipients []string) ([]error, error) {
+	if err := client.Mail(from); err != nil {
+		return nil, err
+	}
+
+	replies := make([]error, len(recipients))
+	if ok, _ := client.Extension("PIPELINING"); !ok {
+		for i, recipient := range recipients {
+			replies[i] = client.Rcpt(pathAddress(recipient))
+		}
+		return replies, nil
+	}
+
+	for _, recipient := range recipients {
+		fmt.Fprintf(client.Text.W, "RCPT TO:%s\r\n", pathAddress(recipient))
+	}
+	if err := client.Text.W.Flush(); err != nil {
+		return nil, err
+	}
+
+	// Read all replies to keep the connection in sync
+	for i := range recipients {
+		_, _, replies[i] = client.Text.ReadResponse(25)
+		if replies[i] != nil && replyCode(replies[i]) == 0 {
+			return nil, replies[i]
+		}
+	}
+	return replies, nil
+}
+
+// data sends the message to the recipients of the transaction
+func data(client *smtp.Client, msg *mail.Msg) error {
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := msg.WriteTo(w); err != nil {
+		return err
+	}
+	return w.Close()
+}
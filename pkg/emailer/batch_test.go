@@ -0,0 +1,177 @@
+package emailer
+
+import (
+	"bufio"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wneessen/go-mail/smtp"
+)
+
+// fakeSMTP serves a single connection, rejecting the senders and recipients
+// containing "blocked". With pipelining the replies to the RCPT commands are
+// held back until all of them are received, so a client waiting for a reply
+// in between runs into the deadline.
+func fakeSMTP(t *testing.T, pipelining bool, rcpts int) (*smtp.Client, func() []string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var mu sync.Mutex
+	var commands []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+		r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+		w.WriteString("220 fake ESMTP\r\n")
+		w.Flush()
+
+		pending := 0
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.TrimRight(line, "\r\n")
+			mu.Lock()
+			commands = append(commands, command)
+			mu.Unlock()
+
+			verb, _, _ := strings.Cut(command, ":")
+			switch strings.ToUpper(strings.Fields(verb)[0]) {
+			case "EHLO":
+				w.WriteString("250-fake\r\n250-8BITMIME\r\n")
+				if pipelining {
+					w.WriteString("250-PIPELINING\r\n")
+				}
+				w.WriteString("250 SIZE 1000000\r\n")
+			case "MAIL", "RCPT":
+				if strings.Contains(command, "blocked") {
+					w.WriteString("550 5.7.1 rejected\r\n")
+				} else {
+					w.WriteString("250 2.1.0 ok\r\n")
+				}
+				if verb == "RCPT TO" {
+					pending++
+				}
+				if pipelining && pending > 0 && pending < rcpts {
+					continue
+				}
+			case "QUIT":
+				w.WriteString("221 bye\r\n")
+				w.Flush()
+				return
+			default:
+				w.WriteString("250 ok\r\n")
+			}
+			w.Flush()
+		}
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := smtp.NewClient(conn, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Quit()
+		<-done
+	})
+	return client, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(commands)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	tests := []struct {
+		name       string
+		pipelining bool
+		from       string
+		recipients []string
+		rejected   []int
+		wantErr    bool
+		commands   []string
+	}{
+		{
+			name:       "pipelined",
+			pipelining: true,
+			from:       "<ci@example.com>",
+			recipients: []string{"jane@example.com", "John <john@example.com>"},
+			commands:   []string{"MAIL FROM:<ci@example.com> BODY=8BITMIME", "RCPT TO:<jane@example.com>", "RCPT TO:<john@example.com>"},
+		},
+		{
+			name:       "pipelined with rejected recipient",
+			pipelining: true,
+			from:       "<ci@example.com>",
+			recipients: []string{"jane@example.com", "blocked@example.com", "john@example.com"},
+			rejected:   []int{1},
+			commands:   []string{"MAIL FROM:<ci@example.com> BODY=8BITMIME", "RCPT TO:<jane@example.com>", "RCPT TO:<blocked@example.com>", "RCPT TO:<john@example.com>"},
+		},
+		{
+			name:       "pipelined with rejected sender",
+			pipelining: true,
+			from:       "<blocked@example.com>",
+			recipients: []string{"jane@example.com"},
+			wantErr:    true,
+			commands:   []string{"MAIL FROM:<blocked@example.com> BODY=8BITMIME"},
+		},
+		{
+			name:       "sequential",
+			from:       "<ci@example.com>",
+			recipients: []string{"jane@example.com", "blocked@example.com"},
+			rejected:   []int{1},
+			commands:   []string{"MAIL FROM:<ci@example.com> BODY=8BITMIME", "RCPT TO:<jane@example.com>", "RCPT TO:<blocked@example.com>"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, commands := fakeSMTP(t, test.pipelining, len(test.recipients))
+
+			replies, err := transaction(client, test.from, test.recipients)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("transaction() error = %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr {
+				if len(replies) != len(test.recipients) {
+					t.Fatalf("transaction() = %d replies, want %d", len(replies), len(test.recipients))
+				}
+				for i, reply := range replies {
+					if rejected := slices.Contains(test.rejected, i); (reply != nil) != rejected {
+						t.Errorf("reply to %s = %v, want rejected %v", test.recipients[i], reply, rejected)
+					}
+				}
+			}
+
+			if err := client.Noop(); err != nil {
+				t.Fatalf("connection out of sync: %v", err)
+			}
+			got := slices.DeleteFunc(commands(), func(command string) bool {
+				return strings.HasPrefix(command, "EHLO") || command == "NOOP"
+			})
+			if !slices.Equal(got, test.commands) {
+				t.Errorf("commands = %q, want %q", got, test.commands)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package emailer
+
+// Brand customizes the look of the built-in templates
+type Brand struct {
+	Name  string
+	Logo  string
+	Color string
+}
+
+// brand returns the configured branding or nil if no branding is configured
+func (p Plugin) brand() *Brand {
+	if p.Config.BrandName == "" && p.Config.BrandLogoURL == "" && p.Config.BrandColor == "" {
+		return nil
+	}
+
+	return &Brand{
+		Name:  p.Config.BrandName,
+		Logo:  p.Config.BrandLogoURL,
+		Color: p.Config.BrandColor,
+	}
+}
@@ -0,0 +1,70 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+
+	mail "github.com/wneessen/go-mail"
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/azureblob"
+	_ "gocloud.dev/blob/gcsblob"
+	_ "gocloud.dev/blob/s3blob"
+)
+
+// messageArchive uploads sent messages to a S3, GCS or Azure Blob Storage
+// bucket
+type messageArchive struct {
+	bucket *blob.Bucket
+	prefix string
+}
+
+// openArchive opens the bucket configured as archive. It returns nil if no
+// archive is configured.
+func (p Plugin) openArchive(ctx context.Context) (*messageArchive, error) {
+	if p.Config.ArchiveURL == "" {
+		return nil, nil
+	}
+
+	bucket, err := blob.OpenBucket(ctx, p.Config.ArchiveURL)
+	if err != nil {
+		return nil, err
+	}
+	return &messageArchive{
+		bucket: bucket,
+		prefix: path.Join(p.Repo.FullName, strconv.Itoa(p.Build.Number)),
+	}, nil
+}
+
+// upload stores the message to the recipient as .eml file below the
+// repository and build number
+func (a *messageArchive) upload(ctx context.Context, recipient string, msg *mail.Msg) error {
+	if a == nil {
+		return nil
+	}
+
+	key := path.Join(a.prefix, emlName(recipient))
+	w, err := a.bucket.NewWriter(ctx, key, &blob.WriterOptions{
+		ContentType: "message/rfc822",
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := msg.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("could not upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// Close closes the bucket
+func (a *messageArchive) Close() error {
+	if a == nil {
+		return nil
+	}
+	return a.bucket.Close()
+}
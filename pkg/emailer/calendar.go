@@ -0,0 +1,105 @@
+package emailer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultCalendarSummary is the default summary template of the calendar entry
+const DefaultCalendarSummary = `
+Deployed {{ repo.name }}{{#if tag}} {{ tag }}{{/if}}{{#if deployTo}} to {{ deployTo }}{{/if}}
+`
+
+const calendarTimeFormat = "20060102T150405Z"
+
+// calendarEvents are the build events for which a calendar entry is attached
+var calendarEvents = map[string]bool{
+	"promote":  true,
+	"rollback": true,
+	"tag":      true,
+}
+
+// calendar returns an iCalendar entry describing the deployment or nil for
+// builds which are no deployments
+func (p Plugin) calendar(ctx interface{}) (*attachment, error) {
+	if !p.Config.Calendar || !calendarEvents[p.Build.Event] {
+		return nil, nil
+	}
+
+	summary, err := renderInline(p.Config.CalendarSummary, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Unix(int64(p.Build.Started), 0)
+	if p.Build.Started == 0 {
+		start = time.Now()
+	}
+	end := time.Unix(int64(p.Build.Finished), 0)
+	if p.Build.Finished == 0 || end.Before(start) {
+		end = time.Now()
+	}
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//drone-plugins//drone-email//EN",
+		"METHOD:PUBLISH",
+		"BEGIN:VEVENT",
+		fmt.Sprintf("UID:%s-%d@drone", strings.ReplaceAll(p.Repo.FullName, "/", "-"), p.Build.Number),
+		"DTSTAMP:" + time.Now().UTC().Format(calendarTimeFormat),
+		"DTSTART:" + start.UTC().Format(calendarTimeFormat),
+		"DTEND:" + end.UTC().Format(calendarTimeFormat),
+		"SUMMARY:" + escapeCalendarText(summary),
+		"DESCRIPTION:" + escapeCalendarText(fmt.Sprintf("Build #%d %s\n%s", p.Build.Number, p.Build.Status, p.Build.Link)),
+	}
+	if p.Build.Link != "" {
+		lines = append(lines, "URL:"+p.Build.Link)
+	}
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+
+	var data strings.Builder
+	for _, line := range lines {
+		data.WriteString(foldCalendarLine(line))
+		data.WriteString("\r\n")
+	}
+
+	return &attachment{
+		Name:        "deployment.ics",
+		Data:        []byte(data.String()),
+		ContentType: "text/calendar; method=PUBLISH",
+	}, nil
+}
+
+// escapeCalendarText escapes a TEXT value according to RFC 5545
+func escapeCalendarText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// foldCalendarLine folds content lines longer than 75 octets, continuation
+// lines hold 74 octets after the leading space
+func foldCalendarLine(line string) string {
+	limit := 75
+
+	var folded strings.Builder
+	for len(line) > limit {
+		cut := limit
+		// never split a multi-byte character
+		for cut > 0 && line[cut]&0xc0 == 0x80 {
+			cut--
+		}
+		folded.WriteString(line[:cut])
+		folded.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	folded.WriteString(line)
+	return folded.String()
+}
@@ -0,0 +1,65 @@
+package emailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFoldCalendarLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "short", line: "SUMMARY:Deploy"},
+		{name: "exact", line: "SUMMARY:" + strings.Repeat("x", 67)},
+		{name: "long", line: "DESCRIPTION:" + strings.Repeat("x", 300)},
+		{name: "multi-byte", line: "DESCRIPTION:" + strings.Repeat("ä", 100)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			folded := foldCalendarLine(test.line)
+			for i, line := range strings.Split(folded, "\r\n") {
+				if len(line) > 75 {
+					t.Errorf("line %d is %d octets long, want at most 75", i, len(line))
+				}
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("line %d = %q, want a leading space", i, line)
+				}
+			}
+			if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != test.line {
+				t.Errorf("unfolded line = %q, want %q", unfolded, test.line)
+			}
+		})
+	}
+}
+
+func TestCalendarSummary(t *testing.T) {
+	ctx := map[string]interface{}{
+		"repo": map[string]interface{}{"name": "R&D <tools>"},
+		"tag":  "v1.2",
+	}
+
+	tests := []struct {
+		summary string
+		want    string
+	}{
+		{summary: "Deployed {{ repo.name }} {{ tag }}", want: "SUMMARY:Deployed R&D <tools> v1.2"},
+		{summary: "{{ repo.name }}, {{ tag }}; done", want: `SUMMARY:R&D <tools>\, v1.2\; done`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.summary, func(t *testing.T) {
+			p := Plugin{Config: Config{Calendar: true, CalendarSummary: test.summary}}
+			p.Build.Event = "promote"
+
+			a, err := p.calendar(ctx)
+			if err != nil {
+				t.Fatalf("calendar() error = %v", err)
+			}
+			if !strings.Contains(string(a.Data), "\r\n"+test.want+"\r\n") {
+				t.Errorf("calendar() = %q, want line %q", a.Data, test.want)
+			}
+		})
+	}
+}
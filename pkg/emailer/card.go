@@ -0,0 +1,34 @@
+package emailer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// cardSchema is the adaptive card template rendering the delivery report
+const cardSchema = "https://drone-plugins.github.io/drone-email/card.json"
+
+// writeCard writes the delivery report as card to the card path provided by
+// Drone, which shows it in the build UI
+func (p Plugin) writeCard(r *deliveryReport) error {
+	if p.Config.CardPath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(struct {
+		Schema string          `json:"schema"`
+		Data   *deliveryReport `json:"data"`
+	}{cardSchema, r})
+	if err != nil {
+		return err
+	}
+
+	// The runner reads cards written to stdout from an escape sequence
+	if p.Config.CardPath == "/dev/stdout" {
+		_, err := fmt.Printf("\u001B]1338;%s\u001B]0m\n", base64.StdEncoding.EncodeToString(data))
+		return err
+	}
+	return os.WriteFile(p.Config.CardPath, data, 0o644)
+}
@@ -0,0 +1,67 @@
+package emailer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	mail "github.com/wneessen/go-mail"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// metaCharset matches the charset declared by a meta tag of the HTML body
+var metaCharset = regexp.MustCompile(`(?i)(<meta[^>]*charset=["']?)[\w.:-]+`)
+
+// bodyCharset is the charset the subject and bodies are encoded in
+type bodyCharset struct {
+	name     mail.Charset
+	encoding encoding.Encoding
+}
+
+// charset returns the configured charset, UTF-8 unless set
+func (p Plugin) charset() (*bodyCharset, error) {
+	if p.Config.Charset == "" || strings.EqualFold(p.Config.Charset, "utf-8") || strings.EqualFold(p.Config.Charset, "utf8") {
+		return &bodyCharset{name: mail.CharsetUTF8}, nil
+	}
+
+	enc, err := ianaindex.MIME.Encoding(p.Config.Charset)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("unsupported charset %q", p.Config.Charset)
+	}
+	name, err := ianaindex.MIME.Name(enc)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", p.Config.Charset)
+	}
+	return &bodyCharset{name: mail.Charset(name), encoding: enc}, nil
+}
+
+// text encodes the text, replacing characters the charset can't represent
+// with a question mark
+func (c *bodyCharset) text(s string) string {
+	if c.encoding == nil {
+		return s
+	}
+
+	encoder := c.encoding.NewEncoder()
+	var out strings.Builder
+	for _, r := range s {
+		encoded, err := encoder.String(string(r))
+		if err != nil {
+			encoded = "?"
+		}
+		out.WriteString(encoded)
+	}
+	return out.String()
+}
+
+// html encodes the HTML, replacing characters the charset can't represent
+// with character references and declaring the charset in meta tags
+func (c *bodyCharset) html(s string) string {
+	if c.encoding == nil {
+		return s
+	}
+	s = metaCharset.ReplaceAllString(s, "${1}"+string(c.name))
+	out, _ := encoding.HTMLEscapeUnsupported(c.encoding.NewEncoder()).String(s)
+	return out
+}
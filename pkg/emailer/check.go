@@ -0,0 +1,84 @@
+package emailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// check verifies the connection to the SMTP server, including TLS and
+// authentication, without sending a message
+func (p Plugin) check(ctx context.Context) error {
+	log.Infof("Checking SMTP server %s:%d", p.Config.Host, p.Config.Port)
+
+	client, err := p.newClient()
+	if err != nil {
+		log.Errorf("FAIL configuration: %v", err)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	// Dialing negotiates TLS and authenticates as configured
+	smtpClient, err := client.DialToSMTPClientWithContext(ctx)
+	if err != nil {
+		log.Errorf("FAIL connect: %v", err)
+		if p.Config.TLSRequired {
+			for _, line := range strings.Split(strings.TrimSpace(p.tlsDiagnostics()), "\n") {
+				log.Error(line)
+			}
+		}
+		return fmt.Errorf("smtp check failed: %w", err)
+	}
+	defer client.CloseWithSMTPClient(smtpClient)
+	log.Infof("PASS connect: %s", client.ServerAddr())
+
+	if state, ok := smtpClient.TLSConnectionState(); ok {
+		log.Infof("PASS tls: %s, %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	} else {
+		log.Warn("SKIP tls: connection is not encrypted")
+	}
+
+	if p.Config.Username != "" && p.Config.Password != "" {
+		log.Infof("PASS auth: authenticated as %s", p.Config.Username)
+	} else {
+		log.Info("SKIP auth: no credentials configured")
+	}
+
+	if err := smtpClient.Noop(); err != nil {
+		log.Errorf("FAIL noop: %v", err)
+		return fmt.Errorf("smtp check failed: %w", err)
+	}
+	log.Info("PASS noop")
+
+	if err := client.ResetWithSMTPClient(smtpClient); err != nil {
+		log.Errorf("FAIL rset: %v", err)
+		return fmt.Errorf("smtp check failed: %w", err)
+	}
+	log.Info("PASS rset")
+
+	log.Info("SMTP check passed")
+	return nil
+}
+
+// supportsExtension connects to the SMTP server and reports whether it
+// advertises the extension, e.g. SMTPUTF8
+func (p Plugin) supportsExtension(ctx context.Context, extension string) (bool, error) {
+	client, err := p.newClient()
+	if err != nil {
+		return false, err
+	}
+	smtpClient, err := client.DialToSMTPClientWithContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer client.CloseWithSMTPClient(smtpClient)
+
+	ok, _ := smtpClient.Extension(extension)
+	return ok, nil
+}
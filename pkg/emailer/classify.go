@@ -0,0 +1,105 @@
+package emailer
+
+import (
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Failure categories detected by the built-in rules
+const (
+	FailureCompile        = "compile"
+	FailureTest           = "test"
+	FailureTimeout        = "timeout"
+	FailureInfrastructure = "infrastructure"
+	FailureUnknown        = "unknown"
+)
+
+type (
+	// Failure is the classification of a failed build exposed to the templates
+	Failure struct {
+		Category string
+		Hint     string
+		Match    string
+	}
+
+	failureRule struct {
+		category string
+		pattern  *regexp.Regexp
+	}
+)
+
+// defaultFailureRules are evaluated in order after the user provided rules
+var defaultFailureRules = []failureRule{
+	{FailureInfrastructure, regexp.MustCompile(`(?i)(connection refused|connection reset|no such host|network is unreachable|i/o timeout|tls handshake timeout|could not resolve host|temporary failure in name resolution|toomanyrequests|rate limit exceeded|no space left on device|out of memory|oomkilled)`)},
+	{FailureTimeout, regexp.MustCompile(`(?i)(context deadline exceeded|timed out after|test timed out|execution timeout|exceeded the (time|timeout) limit)`)},
+	{FailureCompile, regexp.MustCompile(`(?im)(^\S+\.go:\d+:\d+: |^\S+:\d+(:\d+)?: (fatal )?error: |^error(\[E\d+\])?: |compilation (failed|error)|cannot find symbol|syntax error)`)},
+	{FailureTest, regexp.MustCompile(`(?im)(^\s*--- FAIL: |^FAIL\s|^FAILED |Tests run: \d+, Failures: [1-9]|\d+ (tests? )?failed|AssertionError)`)},
+}
+
+// defaultFailureHints are the remediation hints of the built-in categories
+var defaultFailureHints = map[string]string{
+	FailureCompile:        "The code failed to compile, check the compiler errors in the logs.",
+	FailureTest:           "One or more tests failed, check the test output for the failing assertions.",
+	FailureTimeout:        "The build exceeded its time limit, look for hanging processes or increase the timeout.",
+	FailureInfrastructure: "The failure looks infrastructure related (network, registry or resources), restarting the build may help.",
+}
+
+// classifyFailure classifies a failed build based on its logs and exit code
+func (p Plugin) classifyFailure(logs *Logs) *Failure {
+	if !p.Config.ClassifyFailures {
+		return nil
+	}
+	switch p.Build.Status {
+	case "failure", "error", "killed":
+	default:
+		return nil
+	}
+
+	rules := make([]failureRule, 0, len(p.Config.FailureRules)+len(defaultFailureRules))
+	for _, rule := range p.Config.FailureRules {
+		category, pattern, ok := strings.Cut(rule, "=")
+		if !ok {
+			log.Warnf("Skipping failure rule %q, expected category=pattern", rule)
+			continue
+		}
+		expr, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Warnf("Skipping invalid failure rule %q: %v", rule, err)
+			continue
+		}
+		rules = append(rules, failureRule{strings.TrimSpace(category), expr})
+	}
+	rules = append(rules, defaultFailureRules...)
+
+	failure := &Failure{Category: FailureUnknown}
+
+	text := logs.Text()
+	for _, rule := range rules {
+		if match := rule.pattern.FindString(text); match != "" {
+			failure.Category = rule.category
+			failure.Match = strings.TrimSpace(match)
+			break
+		}
+	}
+
+	// fall back to well known exit codes
+	if failure.Category == FailureUnknown {
+		switch p.Job.ExitCode {
+		case 124:
+			failure.Category = FailureTimeout
+		case 137:
+			failure.Category = FailureInfrastructure
+		}
+	}
+
+	failure.Hint = defaultFailureHints[failure.Category]
+	for _, hint := range p.Config.FailureHints {
+		if category, text, ok := strings.Cut(hint, "="); ok && strings.TrimSpace(category) == failure.Category {
+			failure.Hint = strings.TrimSpace(text)
+		}
+	}
+
+	return failure
+}
@@ -0,0 +1,188 @@
+package emailer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Coverage is the code coverage summary exposed to the templates
+	Coverage struct {
+		Percent     float64
+		Baseline    float64
+		Delta       float64
+		HasBaseline bool
+	}
+
+	coberturaReport struct {
+		LineRate     float64 `xml:"line-rate,attr"`
+		LinesValid   int     `xml:"lines-valid,attr"`
+		LinesCovered int     `xml:"lines-covered,attr"`
+	}
+)
+
+// coverage parses the configured coverage report and compares it with the
+// configured baseline report if present
+func (p Plugin) coverage() *Coverage {
+	if p.Config.CoverageReport == "" {
+		return nil
+	}
+
+	percent, err := parseCoverageFile(p.Config.CoverageReport)
+	if err != nil {
+		log.Warnf("Could not parse coverage report %s: %v", p.Config.CoverageReport, err)
+		return nil
+	}
+
+	coverage := &Coverage{Percent: round2(percent)}
+
+	if p.Config.CoverageBaseline != "" {
+		baseline, err := parseCoverageFile(p.Config.CoverageBaseline)
+		if err != nil {
+			log.Warnf("Could not parse coverage baseline %s: %v", p.Config.CoverageBaseline, err)
+			return coverage
+		}
+
+		coverage.HasBaseline = true
+		coverage.Baseline = round2(baseline)
+		coverage.Delta = round2(percent - baseline)
+	}
+
+	return coverage
+}
+
+// parseCoverageFile detects the format of the coverage report and returns the
+// total line coverage in percent. Supported are cobertura XML, go cover
+// profiles, lcov tracefiles and files containing a plain percentage.
+func parseCoverageFile(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("mode:")):
+		return parseGoCoverage(trimmed)
+	case bytes.Contains(trimmed, []byte("<coverage")):
+		return parseCobertura(trimmed)
+	case bytes.Contains(trimmed, []byte("SF:")):
+		return parseLcov(trimmed)
+	}
+
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(string(trimmed), "%"), 64)
+	if err != nil {
+		return 0, errors.New("unknown coverage format")
+	}
+	return percent, nil
+}
+
+func parseCobertura(data []byte) (float64, error) {
+	var report coberturaReport
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return 0, err
+	}
+
+	if report.LinesValid > 0 {
+		return percentOf(report.LinesCovered, report.LinesValid), nil
+	}
+	return report.LineRate * 100, nil
+}
+
+func parseGoCoverage(data []byte) (float64, error) {
+	type block struct {
+		statements int
+		covered    bool
+	}
+	blocks := make(map[string]*block)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+
+		// name.go:line.column,line.column numberOfStatements count
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return 0, fmt.Errorf("invalid cover profile line %q", line)
+		}
+		statements, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0, err
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return 0, err
+		}
+
+		// merged profiles may contain the same block multiple times
+		b, ok := blocks[fields[0]]
+		if !ok {
+			b = &block{statements: statements}
+			blocks[fields[0]] = b
+		}
+		b.covered = b.covered || count > 0
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	var total, covered int
+	for _, b := range blocks {
+		total += b.statements
+		if b.covered {
+			covered += b.statements
+		}
+	}
+	return percentOf(covered, total), nil
+}
+
+func parseLcov(data []byte) (float64, error) {
+	var found, hit int
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "LF:"):
+			n, err := strconv.Atoi(line[3:])
+			if err != nil {
+				return 0, err
+			}
+			found += n
+		case strings.HasPrefix(line, "LH:"):
+			n, err := strconv.Atoi(line[3:])
+			if err != nil {
+				return 0, err
+			}
+			hit += n
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return percentOf(hit, found), nil
+}
+
+func percentOf(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
@@ -1,4 +1,4 @@
-package main
+package emailer
 
 const (
 	// DefaultPort is the default SMTP port to use
@@ -157,6 +157,14 @@ const DefaultTemplate = `
       .alert.alert-good {
         background: #68b90f;
       }
+      {{#if brand.color}}
+        a {
+          color: {{ brand.color }};
+        }
+        .main {
+          border-top: 4px solid {{ brand.color }};
+        }
+      {{/if}}
       @media only screen and (max-width: 640px) {
         h1,
         h2,
@@ -189,6 +197,20 @@ const DefaultTemplate = `
         <td></td>
         <td class="container" width="600">
           <div class="content">
+            {{#if brand}}
+              <table class="header" width="100%" cellpadding="0" cellspacing="0">
+                <tr>
+                  <td class="aligncenter">
+                    {{#if brand.logo}}
+                      <img src="{{ brand.logo }}" alt="{{ brand.name }}" height="40">
+                    {{/if}}
+                    {{#if brand.name}}
+                      <h3 class="first">{{ brand.name }}</h3>
+                    {{/if}}
+                  </td>
+                </tr>
+              </table>
+            {{/if}}
             <table class="main" width="100%" cellpadding="0" cellspacing="0">
               <tr>
                 {{#equal build.status "success"}}
@@ -208,6 +230,16 @@ const DefaultTemplate = `
               <tr>
                 <td class="content-wrap">
                   <table width="100%" cellpadding="0" cellspacing="0">
+                    {{#if badge}}
+                      <tr>
+                        <td>
+                          Status:
+                        </td>
+                        <td>
+                          <img src="{{ badge }}" alt="{{ build.status }}">
+                        </td>
+                      </tr>
+                    {{/if}}
                     <tr>
                       <td>
                         Repo:
@@ -248,6 +280,16 @@ const DefaultTemplate = `
                         {{ datetime build.created "Mon Jan 2 15:04:05 MST 2006" "Local" }}
                       </td>
                     </tr>
+                    {{#if qrcode}}
+                      <tr>
+                        <td>
+                          Build:
+                        </td>
+                        <td>
+                          <img src="{{ qrcode }}" alt="{{ build.link }}">
+                        </td>
+                      </tr>
+                    {{/if}}
                   </table>
                   <hr>
                   <table width="100%" cellpadding="0" cellspacing="0">
@@ -257,6 +299,86 @@ const DefaultTemplate = `
                       </td>
                     </tr>
                   </table>
+                  {{#if digest}}
+                    <hr>
+                    <table width="100%" cellpadding="0" cellspacing="0">
+                      {{#each digest.builds}}
+                        <tr>
+                          <td>
+                            <a href="{{ link }}">{{ repo }} #{{ number }}</a>
+                          </td>
+                          <td>
+                            {{ status }} on {{ branch }} by {{ author }}
+                          </td>
+                        </tr>
+                      {{/each}}
+                    </table>
+                  {{/if}}
+                  {{#if jobs}}
+                    <hr>
+                    <table width="100%" cellpadding="0" cellspacing="0">
+                      {{#each jobs}}
+                        <tr>
+                          <td>
+                            {{#if name}}{{ name }}{{else}}Job {{ number }}{{/if}}:
+                          </td>
+                          <td>
+                            {{ status }}
+                          </td>
+                        </tr>
+                      {{/each}}
+                    </table>
+                  {{/if}}
+                  {{#if junit}}
+                    <hr>
+                    <table width="100%" cellpadding="0" cellspacing="0">
+                      <tr>
+                        <td>
+                          Tests:
+                        </td>
+                        <td>
+                          {{ junit.total }} total, {{ junit.passed }} passed, {{ junit.failed }} failed, {{ junit.errored }} errored, {{ junit.skipped }} skipped
+                        </td>
+                      </tr>
+                      {{#each junit.failures}}
+                        <tr>
+                          <td>
+                            {{ classname }} {{ name }}
+                          </td>
+                          <td>
+                            {{ message }}
+                          </td>
+                        </tr>
+                      {{/each}}
+                      {{#if junit.slowest}}
+                        <tr>
+                          <td>
+                            Slowest:
+                          </td>
+                          <td>
+                            {{#each junit.slowest}}
+                              {{ classname }} {{ name }} ({{ this.duration }}s)<br>
+                            {{/each}}
+                          </td>
+                        </tr>
+                      {{/if}}
+                    </table>
+                  {{/if}}
+                  {{#if artifacts}}
+                    <hr>
+                    <table width="100%" cellpadding="0" cellspacing="0">
+                      <tr>
+                        <td>
+                          Downloads:
+                        </td>
+                        <td>
+                          {{#each artifacts}}
+                            <a href="{{ url }}">{{ name }}</a><br>
+                          {{/each}}
+                        </td>
+                      </tr>
+                    </table>
+                  {{/if}}
                 </td>
               </tr>
             </table>
@@ -268,3 +390,50 @@ const DefaultTemplate = `
   </body>
 </html>
 `
+
+// DefaultTextTemplate is the default plain text body template to use for the
+// email in text format
+const DefaultTextTemplate = `
+{{#equal build.status "success"}}Successful{{else}}Failed{{/equal}} build #{{ build.number }}
+{{{ build.link }}}
+
+Repo:       {{{ repo.owner }}}/{{{ repo.name }}}
+Author:     {{{ commit.author.name }}} ({{{ commit.author.email }}})
+Branch:     {{{ commit.branch }}}
+Commit:     {{ truncate commit.sha 8 }}
+Started at: {{ datetime build.created "Mon Jan 2 15:04:05 MST 2006" "Local" }}
+
+{{{ commit.message }}}
+{{#if digest}}
+
+{{#each digest.builds}}
+{{{ repo }}} #{{ number }}: {{ status }} on {{{ branch }}} by {{{ author }}}
+{{/each}}
+{{/if}}
+{{#if jobs}}
+
+{{#each jobs}}
+{{#if name}}{{{ name }}}{{else}}Job {{ number }}{{/if}}: {{ status }}
+{{/each}}
+{{/if}}
+{{#if junit}}
+
+Tests: {{ junit.total }} total, {{ junit.passed }} passed, {{ junit.failed }} failed, {{ junit.errored }} errored, {{ junit.skipped }} skipped
+{{#each junit.failures}}
+{{{ classname }}} {{{ name }}}: {{{ message }}}
+{{/each}}
+{{#if junit.slowest}}
+Slowest:
+{{#each junit.slowest}}
+{{{ classname }}} {{{ name }}}: {{ this.duration }}s
+{{/each}}
+{{/if}}
+{{/if}}
+{{#if artifacts}}
+
+Downloads:
+{{#each artifacts}}
+{{{ name }}}: {{{ url }}}
+{{/each}}
+{{/if}}
+`
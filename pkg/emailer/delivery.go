@@ -0,0 +1,287 @@
+package emailer
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// greylistMaxWaits limits how often the plugin waits for greylisting to
+// pass for a single message
+const greylistMaxWaits = 3
+
+// greylistInterval matches the interval greylisting servers advertise in the
+// reply like "try again in 300 seconds" or "retry in 5 minutes"
+var greylistInterval = regexp.MustCompile(`(?i)\bin\s+(\d+)\s*(seconds?|secs?|s|minutes?|mins?|m)\b`)
+
+// delivery records the results of the workers sending the messages
+type delivery struct {
+	report  *deliveryReport
+	metrics *deliveryMetrics
+	audit   *auditLog
+	archive *messageArchive
+	mailbox *localMailbox
+	sent    *sentFolder
+
+	mu         sync.Mutex
+	failed     int
+	unarchived int
+
+	// err is the first error stopping the delivery
+	err error
+}
+
+// abort stops the delivery of the remaining messages with the error
+func (d *delivery) abort(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// aborted reports whether the delivery was stopped
+func (d *delivery) aborted() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err != nil
+}
+
+// dialClients dials the client and up to concurrency - 1 additional
+// connections, but not more than recipients. Additional connections failing
+// to connect are skipped, a custom Sender is only dialed once.
+func (p Plugin) dialClients(ctx context.Context, client Sender, recipients int) ([]Sender, error) {
+	if err := client.DialWithContext(ctx); err != nil {
+		return nil, err
+	}
+	clients := []Sender{client}
+	if p.Sender != nil {
+		return clients, nil
+	}
+
+	for len(clients) < min(p.Config.Concurrency, recipients) {
+		client, err := p.newClient()
+		if err == nil {
+			err = client.DialWithContext(ctx)
+		}
+		if err != nil {
+			log.Warnf("Could not open SMTP connection %d, sending over %d: %v", len(clients)+1, len(clients), err)
+			break
+		}
+		clients = append(clients, client)
+	}
+	if len(clients) > 1 {
+		log.Infof("Sending over %d SMTP connections", len(clients))
+	}
+	return clients, nil
+}
+
+// deliverEach sends a message to each recipient over all connections
+// concurrently, a failed recipient does not stop the others from being sent
+// to. It returns the error of the context if it was done before all messages
+// were sent.
+func (p Plugin) deliverEach(ctx context.Context, timing *timings, clients []Sender, recipientsMap map[string]struct{}, content message, d *delivery) error {
+	clients, stopKeepalive := p.keepalive(p.recycle(ctx, clients))
+	defer stopKeepalive()
+
+	recipients := make(chan string)
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for recipient := range recipients {
+				if err := p.deliver(ctx, timing, client, recipient, content, d); err != nil {
+					d.abort(err)
+				}
+			}
+		}()
+	}
+
+	// Stop before the next transaction once the timeout elapsed, the
+	// remaining messages count as failed
+	var canceled error
+	for recipient := range recipientsMap {
+		if canceled = ctx.Err(); canceled != nil || d.aborted() {
+			break
+		}
+		recipients <- recipient
+	}
+	close(recipients)
+	wg.Wait()
+	return canceled
+}
+
+// deliver sends the message to the recipient over the client and records the
+// result. Failed sends are recorded, only errors that should stop the
+// delivery of all messages are returned.
+func (p Plugin) deliver(ctx context.Context, timing *timings, client Sender, recipient string, content message, d *delivery) error {
+	started := time.Now()
+	fields := log.Fields{
+		"recipient": p.logRecipient(recipient),
+		"repo":      p.Repo.FullName,
+		"build":     p.Build.Number,
+	}
+
+	msg, err := p.newMessage(recipient, content)
+	if err != nil {
+		return err
+	}
+	if err := p.writeMessage(recipient, msg); err != nil {
+		log.Errorf("Could not save message: %v", err)
+		return err
+	}
+
+	// Send using existing connection, retrying temporary failures
+	var latency time.Duration
+	attempts, greylisted, reconnects := 0, 0, 0
+send:
+	for {
+		attempts++
+		_, phase := timing.start(ctx, "send", attribute.String("recipient", p.logRecipient(recipient)))
+		sending := time.Now()
+		err = client.Send(msg)
+		latency += time.Since(sending)
+		phase.end(err)
+
+		if err == nil || !retryable(err) {
+			break
+		}
+
+		// Resend right away if the server dropped the idle connection,
+		// which does not count as retry either
+		if p.Config.Keepalive > 0 && reconnects == 0 && connectionLost(err) {
+			reconnects++
+			log.WithFields(fields).Infof("Connection lost sending email to %q, reconnecting: %v", p.logRecipient(recipient), err)
+			client.Close()
+			if err := client.DialWithContext(ctx); err != nil {
+				log.WithFields(fields).Warnf("Could not reconnect to the SMTP server: %v", err)
+			}
+			continue
+		}
+
+		// Waiting for greylisting to pass does not count as retry
+		delay, ok := p.greylistDelay(err)
+		switch {
+		case ok && greylisted < greylistMaxWaits:
+			greylisted++
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				log.WithFields(fields).Warnf("Greylisted sending email to %q, not waiting %s beyond the timeout", p.logRecipient(recipient), delay)
+				break send
+			}
+			log.WithFields(fields).Infof("Greylisted sending email to %q, retrying in %s: %v", p.logRecipient(recipient), delay, err)
+		case attempts-greylisted-reconnects > p.Config.Retries:
+			break send
+		default:
+			delay = p.retryDelay(attempts - greylisted - reconnects)
+			log.WithFields(fields).Warnf("Temporary failure sending email to %q, retrying in %s: %v", p.logRecipient(recipient), delay, err)
+		}
+		if !sleep(ctx, delay) {
+			break
+		}
+
+		// Reconnect if the connection was lost instead of the message
+		// being rejected, or may have timed out while greylisted
+		if ok || replyCode(err) == 0 {
+			client.Close()
+			if err := client.DialWithContext(ctx); err != nil {
+				log.WithFields(fields).Warnf("Could not reconnect to the SMTP server: %v", err)
+			}
+		}
+	}
+
+	d.mu.Lock()
+	d.metrics.Latency += latency
+	d.audit.record(msg, recipient, content.forRecipient(recipient).Subject, err)
+	d.report.add(p.logRecipient(recipient), msg, time.Since(started), attempts, err)
+	if err != nil {
+		d.failed++
+	} else {
+		d.metrics.Sent++
+	}
+	d.mu.Unlock()
+
+	fields["duration"] = time.Since(started).Milliseconds()
+	if err != nil {
+		log.WithFields(fields).Errorf("Could not send email to %q: %v", p.logRecipient(recipient), err)
+
+		// Keep the message for the next run unless rejected permanently
+		if p.Config.SpoolDir != "" && retryable(err) {
+			if err := p.spool(recipient, msg); err != nil {
+				log.Errorf("Could not spool email to %q: %v", p.logRecipient(recipient), err)
+			} else {
+				log.Infof("Spooled email to %q for the next run", p.logRecipient(recipient))
+			}
+		}
+		return nil
+	}
+	log.WithFields(fields).Infof("Sent email to %q", p.logRecipient(recipient))
+
+	if err := d.archive.upload(ctx, recipient, msg); err != nil {
+		log.Errorf("Could not archive email to %q: %v", p.logRecipient(recipient), err)
+		d.mu.Lock()
+		d.unarchived++
+		d.mu.Unlock()
+	}
+	if err := d.mailbox.write(msg); err != nil {
+		log.Errorf("Could not write email to %q to the mailbox: %v", p.logRecipient(recipient), err)
+		d.mu.Lock()
+		d.unarchived++
+		d.mu.Unlock()
+	}
+	if err := d.sent.append(msg); err != nil {
+		log.Warnf("Could not copy email to %q to the IMAP folder: %v", p.logRecipient(recipient), err)
+	}
+	return nil
+}
+
+// retryDelay returns the delay before retrying a temporary failure of the
+// given attempt, doubling the backoff with every attempt
+func (p Plugin) retryDelay(attempt int) time.Duration {
+	backoff := p.Config.RetryBackoff
+	if backoff <= 0 {
+		backoff = 5 * time.Second
+	}
+	return backoff << (attempt - 1)
+}
+
+// sleep waits for the duration, returning false if the context is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// greylistDelay returns the time to wait before retrying a message the
+// server greylisted with a 450 or 451 reply, the interval advertised in the
+// reply or the configured one. It returns false if not greylisted or waiting
+// for greylisting is disabled.
+func (p Plugin) greylistDelay(err error) (time.Duration, bool) {
+	if p.Config.GreylistWait <= 0 {
+		return 0, false
+	}
+	if code := replyCode(err); code != 450 && code != 451 {
+		return 0, false
+	}
+
+	match := greylistInterval.FindStringSubmatch(err.Error())
+	if match == nil {
+		return p.Config.GreylistWait, true
+	}
+	interval, _ := strconv.Atoi(match[1])
+	if strings.HasPrefix(strings.ToLower(match[2]), "m") {
+		return time.Duration(interval) * time.Minute, true
+	}
+	return time.Duration(interval) * time.Second, true
+}
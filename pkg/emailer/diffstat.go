@@ -0,0 +1,82 @@
+package emailer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// DiffStat summarizes the changes of the commit range of the build
+	DiffStat struct {
+		Files     int
+		Additions int
+		Deletions int
+		Changes   []DiffFile
+	}
+
+	// DiffFile are the changes of a single file
+	DiffFile struct {
+		Path      string
+		Additions int
+		Deletions int
+		Binary    bool
+	}
+)
+
+// Summary returns the changes formatted like git diff --shortstat
+func (d *DiffStat) Summary() string {
+	return fmt.Sprintf("%d files changed, %d insertions(+), %d deletions(-)", d.Files, d.Additions, d.Deletions)
+}
+
+// diffStat computes the diff stats of the commit range of the build using the
+// local git repository. Errors are logged and result in no diff stats.
+func (p Plugin) diffStat() *DiffStat {
+	if !p.Config.DiffStat || p.Commit.Sha == "" {
+		return nil
+	}
+
+	base := p.Commit.Before
+	if base == "" || strings.Trim(base, "0") == "" {
+		base = p.Prev.Commit.Sha
+	}
+	if base == "" || base == p.Commit.Sha {
+		base = p.Commit.Sha + "^"
+	}
+
+	out, err := exec.Command("git", "diff", "--numstat", base, p.Commit.Sha).Output()
+	if err != nil {
+		log.Warnf("Could not compute diff stats for %s..%s: %v", base, p.Commit.Sha, err)
+		return nil
+	}
+
+	stat := new(DiffStat)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// additions<TAB>deletions<TAB>path, binary files use - as counts
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		file := DiffFile{Path: fields[2]}
+		if fields[0] == "-" {
+			file.Binary = true
+		} else {
+			file.Additions, _ = strconv.Atoi(fields[0])
+			file.Deletions, _ = strconv.Atoi(fields[1])
+		}
+
+		stat.Files++
+		stat.Additions += file.Additions
+		stat.Deletions += file.Deletions
+		stat.Changes = append(stat.Changes, file)
+	}
+
+	return stat
+}
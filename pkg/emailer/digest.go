@@ -0,0 +1,140 @@
+package emailer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Digest modes collecting builds and sending them in a single email
+const (
+	DigestCollect = "collect"
+	DigestSend    = "send"
+)
+
+// DefaultDigestSubject is the subject template used for digests unless a
+// subject is set
+const DefaultDigestSubject = `[DIGEST] {{ digest.total }} builds, {{ digest.failed }} failed`
+
+type (
+	// Digest summarizes the builds collected since the last digest for the
+	// templates
+	Digest struct {
+		Builds []DigestBuild
+		Total  int
+		Failed int
+		Since  float64
+	}
+
+	// DigestBuild is a build collected for the digest
+	DigestBuild struct {
+		Repo      string
+		Number    int
+		Status    string
+		Event     string
+		Branch    string
+		Author    string
+		Message   string
+		Link      string
+		Started   float64
+		Finished  float64
+		Collected float64
+	}
+)
+
+// digestBuild returns the current build as collected for the digest
+func (p Plugin) digestBuild() DigestBuild {
+	author := p.Commit.Author.Name
+	if author == "" {
+		author = p.Commit.Author.Email
+	}
+	return DigestBuild{
+		Repo:      p.Repo.FullName,
+		Number:    p.Build.Number,
+		Status:    p.Build.Status,
+		Event:     p.Build.Event,
+		Branch:    p.Commit.Branch,
+		Author:    author,
+		Message:   p.Commit.Message,
+		Link:      p.Build.Link,
+		Started:   p.Build.Started,
+		Finished:  p.Build.Finished,
+		Collected: float64(time.Now().Unix()),
+	}
+}
+
+// collectDigest stores the current build in the digest directory to be
+// sent with the next digest
+func (p Plugin) collectDigest() error {
+	if err := os.MkdirAll(p.Config.DigestDir, 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(p.digestBuild())
+	if err != nil {
+		return err
+	}
+
+	// Rename the written file so a digest being sent never reads a partial
+	// build
+	name := filepath.Join(p.Config.DigestDir, fmt.Sprintf(
+		"%d-%s-%d.json",
+		time.Now().UnixNano(),
+		unsafeFileChars.ReplaceAllString(p.Repo.FullName, "-"),
+		p.Build.Number,
+	))
+	if err := os.WriteFile(name+".tmp", data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+
+	log.Infof("Collected build #%d for the next digest", p.Build.Number)
+	return nil
+}
+
+// readDigest returns the builds collected since the last digest and the
+// files to remove once sent. The current build is included unless the digest
+// is sent by a scheduled build.
+func (p Plugin) readDigest() (*Digest, []string, error) {
+	files, err := filepath.Glob(filepath.Join(p.Config.DigestDir, "*.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(files)
+
+	digest := &Digest{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		var build DigestBuild
+		if err := json.Unmarshal(data, &build); err != nil {
+			log.Warnf("Skipping collected build %s: %v", file, err)
+			continue
+		}
+		digest.Builds = append(digest.Builds, build)
+	}
+	if p.Build.Event != "cron" {
+		digest.Builds = append(digest.Builds, p.digestBuild())
+	}
+
+	for _, build := range digest.Builds {
+		switch build.Status {
+		case "failure", "error", "killed":
+			digest.Failed++
+		}
+		if digest.Since == 0 || build.Collected < digest.Since {
+			digest.Since = build.Collected
+		}
+	}
+	digest.Total = len(digest.Builds)
+	return digest, files, nil
+}
@@ -0,0 +1,105 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// DefaultDownloadTimeout is the default timeout for downloading attachments
+const DefaultDownloadTimeout = 30 * time.Second
+
+// isURL reports whether the attachment entry refers to a remote file
+func isURL(entry string) bool {
+	return strings.HasPrefix(entry, "http://") || strings.HasPrefix(entry, "https://")
+}
+
+// downloadAttachment fetches a remote file honoring the configured timeout,
+// size limit and authentication header
+func (p Plugin) downloadAttachment(ctx context.Context, rawURL string) (attachment, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return attachment{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return attachment{}, err
+	}
+	var headerKey string
+	if p.Config.DownloadHeader != "" {
+		key, value, ok := strings.Cut(p.Config.DownloadHeader, ":")
+		if !ok {
+			return attachment{}, fmt.Errorf("invalid download header, expected Name: value")
+		}
+		headerKey = strings.TrimSpace(key)
+		req.Header.Set(headerKey, strings.TrimSpace(value))
+	}
+
+	timeout := p.Config.DownloadTimeout
+	if timeout <= 0 {
+		timeout = DefaultDownloadTimeout
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		// Keep the credentials of the download header from other hosts
+		// redirected to, e.g. object storage serving the artifacts
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			if headerKey != "" && req.URL.Host != via[0].URL.Host {
+				req.Header.Del(headerKey)
+			}
+			return nil
+		},
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return attachment{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return attachment{}, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	maxSize, err := parseSize(p.Config.DownloadMaxSize)
+	if err != nil {
+		return attachment{}, err
+	}
+
+	body := io.Reader(res.Body)
+	if maxSize > 0 {
+		if res.ContentLength > maxSize {
+			return attachment{}, fmt.Errorf("size of %d bytes exceeds the maximum of %d bytes", res.ContentLength, maxSize)
+		}
+		body = io.LimitReader(res.Body, maxSize+1)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return attachment{}, err
+	}
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return attachment{}, fmt.Errorf("size exceeds the maximum of %d bytes", maxSize)
+	}
+
+	// prefer the file name announced by the server
+	name := path.Base(u.Path)
+	if _, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = path.Base(params["filename"])
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "download"
+	}
+
+	return attachment{Name: name, Data: data}, nil
+}
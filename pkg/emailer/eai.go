@@ -0,0 +1,86 @@
+package emailer
+
+import (
+	"fmt"
+	netmail "net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// isASCII reports whether the string only contains ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// internationalized reports whether any of the addresses contains non-ASCII
+// characters, requiring SMTPUTF8 or IDNA encoded domains
+func internationalized(addresses ...string) bool {
+	for _, address := range addresses {
+		if !isASCII(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// asciiAddress returns the address with the domain encoded as IDNA A-label,
+// keeping the display name. Non-ASCII local parts can't be encoded and need
+// SMTPUTF8.
+func asciiAddress(address string) (string, error) {
+	if isASCII(address) {
+		return address, nil
+	}
+
+	parsed, err := netmail.ParseAddress(address)
+	if err != nil {
+		return "", err
+	}
+	local, domain, _ := strings.Cut(parsed.Address, "@")
+	if !isASCII(local) {
+		return "", fmt.Errorf("%q has a non-ASCII local part, which needs an SMTP server supporting SMTPUTF8", address)
+	}
+	if domain, err = idna.Lookup.ToASCII(domain); err != nil {
+		return "", fmt.Errorf("%q has an invalid domain: %w", address, err)
+	}
+	parsed.Address = local + "@" + domain
+
+	if parsed.Name == "" {
+		return parsed.Address, nil
+	}
+	return parsed.String(), nil
+}
+
+// asciiAddresses replaces the addresses with their IDNA encoded form for
+// servers not supporting SMTPUTF8
+func asciiAddresses(recipients map[string]struct{}, addresses ...*string) error {
+	for _, address := range addresses {
+		ascii, err := asciiAddress(*address)
+		if err != nil {
+			return err
+		}
+		*address = ascii
+	}
+
+	encoded := make(map[string]string)
+	for recipient := range recipients {
+		ascii, err := asciiAddress(recipient)
+		if err != nil {
+			return err
+		}
+		if ascii != recipient {
+			encoded[recipient] = ascii
+		}
+	}
+	for recipient, ascii := range encoded {
+		delete(recipients, recipient)
+		recipients[ascii] = struct{}{}
+	}
+	return nil
+}
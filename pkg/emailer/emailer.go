@@ -0,0 +1,149 @@
+// Package emailer renders and sends the build notification emails of the
+// drone-email plugin. The Plugin can be used by other tools, replacing how
+// recipients are resolved, templates are rendered and messages are sent.
+package emailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aymerick/raymond"
+	"github.com/drone/drone-template-lib/template"
+	log "github.com/sirupsen/logrus"
+	mail "github.com/wneessen/go-mail"
+)
+
+type (
+	// RecipientResolver resolves the addresses the email is sent to
+	RecipientResolver interface {
+		Recipients() ([]string, error)
+	}
+
+	// Renderer renders the body, footer and subject templates with the
+	// build context
+	Renderer interface {
+		Render(template string, data interface{}) (string, error)
+	}
+
+	// Sender delivers the messages over a connection dialed once for all
+	// recipients
+	Sender interface {
+		DialWithContext(ctx context.Context) error
+		Send(messages ...*mail.Msg) error
+		Close() error
+	}
+
+	// templateRenderer renders templates with the drone template helpers,
+	// loading templates given as file path or URL
+	templateRenderer struct {
+		ctx context.Context
+	}
+)
+
+// Render renders the template with the data, trimming the output
+func (r templateRenderer) Render(tpl string, data interface{}) (string, error) {
+	// Fetch remote templates honoring the context, the template library
+	// fetches them without
+	if strings.HasPrefix(tpl, "http://") || strings.HasPrefix(tpl, "https://") {
+		content, err := fetchTemplate(r.ctx, tpl)
+		if err != nil {
+			return "", err
+		}
+		out, err := raymond.Render(content, data)
+		return strings.Trim(out, " \n"), err
+	}
+	return template.RenderTrim(tpl, data)
+}
+
+// fetchTemplate fetches the remote template
+func fetchTemplate(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch: %w", err)
+	}
+	defer res.Body.Close()
+
+	out, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read: %w", err)
+	}
+	return string(out), nil
+}
+
+// Recipients returns the configured recipients, the commit author unless
+// disabled and the recipients listed in the recipients file
+func (p Plugin) Recipients() ([]string, error) {
+	recipients := make(map[string]struct{})
+
+	// Add recipients from the config
+	for _, recipient := range p.Config.Recipients {
+		if recipient == "" {
+			log.Warnf("Skipping empty recipient from config")
+			continue
+		}
+		recipients[recipient] = struct{}{}
+	}
+
+	// Add commit author's email if not already present and RecipientsOnly is false
+	if !p.Config.RecipientsOnly {
+		if p.Commit.Author.Email != "" {
+			recipients[p.Commit.Author.Email] = struct{}{}
+		} else {
+			log.Warn("Commit author email is empty")
+		}
+	}
+
+	// Add recipients from the recipients file
+	if p.Config.RecipientsFile != "" {
+		listed, err := readRecipientsFile(p.Config.RecipientsFile)
+		if err != nil {
+			log.Errorf("Could not open RecipientsFile %s: %v", p.Config.RecipientsFile, err)
+		}
+		for _, recipient := range listed {
+			recipients[recipient.Address] = struct{}{}
+		}
+	}
+
+	resolved := make([]string, 0, len(recipients))
+	for recipient := range recipients {
+		resolved = append(resolved, recipient)
+	}
+	sort.Strings(resolved)
+	return resolved, nil
+}
+
+// resolver returns the configured recipient resolver, defaulting to the
+// plugin configuration
+func (p Plugin) resolver() RecipientResolver {
+	if p.Resolver != nil {
+		return p.Resolver
+	}
+	return p
+}
+
+// renderer returns the configured renderer, defaulting to the drone
+// templates fetched within the context
+func (p Plugin) renderer(ctx context.Context) Renderer {
+	if p.Renderer != nil {
+		return p.Renderer
+	}
+	return templateRenderer{ctx: ctx}
+}
+
+// sender returns the configured sender, defaulting to a client of the
+// configured SMTP server
+func (p Plugin) sender() (Sender, error) {
+	if p.Sender != nil {
+		return p.Sender, nil
+	}
+	return p.newClient()
+}
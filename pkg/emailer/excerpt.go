@@ -0,0 +1,80 @@
+package emailer
+
+import (
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultErrorLines is the default number of error lines extracted from logs
+const DefaultErrorLines = 5
+
+// DefaultErrorPatterns match the error output of common compilers and test
+// runners
+var DefaultErrorPatterns = []string{
+	// go build and vet
+	`^\S+\.go:\d+(:\d+)?: .+`,
+	// go test
+	`^\s*--- FAIL: .+`,
+	`^panic: .+`,
+	// gcc, clang, javac, tsc
+	`^\S+:\d+(:\d+)?: (fatal )?error: .+`,
+	`^\S+\(\d+,\d+\): error .+`,
+	// rustc
+	`^error(\[E\d+\])?: .+`,
+	// maven, gradle
+	`^\[ERROR\] .+`,
+	`^FAILURE: .+`,
+	// npm, yarn
+	`^npm ERR! .+`,
+	// pytest
+	`^(FAILED|ERROR) \S+.*`,
+	`^E\s+.+`,
+	// generic
+	`(?i)^\s*(error|fatal):\s.+`,
+}
+
+// errorExcerpt scans the logs line by line and returns the first lines
+// matching any of the error patterns
+func (p Plugin) errorExcerpt(logs *Logs) []string {
+	if !p.Config.ExtractErrors {
+		return nil
+	}
+
+	patterns := p.Config.ErrorPatterns
+	if len(patterns) == 0 {
+		patterns = DefaultErrorPatterns
+	}
+
+	var rules []*regexp.Regexp
+	for _, pattern := range patterns {
+		rule, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Warnf("Skipping invalid error pattern %q: %v", pattern, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	limit := p.Config.ErrorLines
+	if limit <= 0 {
+		limit = DefaultErrorLines
+	}
+
+	var excerpt []string
+	for _, line := range strings.Split(logs.Text(), "\n") {
+		line = strings.TrimRight(line, "\r")
+		for _, rule := range rules {
+			if rule.MatchString(line) {
+				excerpt = append(excerpt, strings.TrimSpace(line))
+				break
+			}
+		}
+		if len(excerpt) == limit {
+			break
+		}
+	}
+
+	return excerpt
+}
@@ -0,0 +1,130 @@
+package emailer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// expandGlobs expands the given patterns to the list of matching files.
+// Besides the syntax supported by filepath.Match, "**" matches any number of
+// directories. Patterns without any meta characters are returned as is.
+func expandGlobs(patterns []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]struct{})
+
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+
+		matches, err := expandGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			if _, ok := seen[match]; ok {
+				continue
+			}
+			seen[match] = struct{}{}
+			files = append(files, match)
+		}
+	}
+
+	return files, nil
+}
+
+func expandGlob(pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+
+	pattern = filepath.ToSlash(pattern)
+	expr, err := globRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// walk from the deepest directory without meta characters
+	root := "."
+	if i := strings.IndexAny(pattern, "*?["); i > 0 {
+		if j := strings.LastIndex(pattern[:i], "/"); j >= 0 {
+			root = pattern[:j]
+			if root == "" {
+				root = "/"
+			}
+		}
+	}
+
+	var matches []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		if expr.MatchString(strings.TrimPrefix(filepath.ToSlash(path), "./")) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// globRegexp converts a glob pattern into a regular expression
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+
+	pattern = strings.TrimPrefix(pattern, "./")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				expr.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, filepath.ErrBadPattern
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
@@ -0,0 +1,181 @@
+package emailer
+
+import (
+	"fmt"
+	netmail "net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	mail "github.com/wneessen/go-mail"
+)
+
+// reservedHeaders are set by the plugin and can't be overridden by custom
+// headers
+var reservedHeaders = map[string]bool{
+	"From":                      true,
+	"To":                        true,
+	"Cc":                        true,
+	"Bcc":                       true,
+	"Subject":                   true,
+	"Date":                      true,
+	"Mime-Version":              true,
+	"Content-Type":              true,
+	"Content-Transfer-Encoding": true,
+	"Message-Id":                true,
+	"In-Reply-To":               true,
+	"References":                true,
+}
+
+// priorities are the supported message priorities
+var priorities = map[string]mail.Importance{
+	"low":    mail.ImportanceLow,
+	"normal": mail.ImportanceNormal,
+	"high":   mail.ImportanceHigh,
+}
+
+// importance returns the priority of the message. The setting is either a
+// single priority or status=priority entries selecting the priority by build
+// status, e.g. failure=high. The first matching entry wins.
+func (p Plugin) importance() (mail.Importance, error) {
+	for _, entry := range p.Config.Priority {
+		status, priority, ok := strings.Cut(entry, "=")
+		if !ok {
+			status, priority = "", status
+		}
+		status = strings.TrimSpace(status)
+
+		importance, found := priorities[strings.ToLower(strings.TrimSpace(priority))]
+		if !found {
+			return mail.ImportanceNormal, fmt.Errorf("unknown priority %q", priority)
+		}
+		if status == "" || strings.EqualFold(status, p.Build.Status) {
+			return importance, nil
+		}
+	}
+
+	return mail.ImportanceNormal, nil
+}
+
+// senderIdentity returns the from address, from name and reply-to address rendered
+// against the template context
+func (p Plugin) senderIdentity(ctx interface{}) (address, name, replyTo string, err error) {
+	if address, err = renderInline(p.Config.FromAddress, ctx); err != nil {
+		return "", "", "", fmt.Errorf("from address: %w", err)
+	}
+	if name, err = renderInline(p.Config.FromName, ctx); err != nil {
+		return "", "", "", fmt.Errorf("from name: %w", err)
+	}
+	if replyTo, err = renderInline(p.Config.ReplyTo, ctx); err != nil {
+		return "", "", "", fmt.Errorf("reply-to address: %w", err)
+	}
+	return address, name, replyTo, nil
+}
+
+// readReceipt returns the addresses read receipts are requested to. Entries
+// are rendered against the template context and skipped if empty, so
+// receipts can be requested for some builds only.
+func (p Plugin) readReceipt(ctx interface{}) ([]string, error) {
+	var addresses []string
+	for _, entry := range p.Config.ReadReceipt {
+		address, err := renderInline(entry, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses, nil
+}
+
+// headers returns the additional headers of every message, with the custom
+// header values rendered against the template context
+func (p Plugin) headers(ctx interface{}) (map[string]string, error) {
+	headers := make(map[string]string)
+
+	// Keep out-of-office replies and ticketing systems from responding to
+	// the notifications
+	if p.Config.AutoSubmitted {
+		headers["Auto-Submitted"] = "auto-generated"
+		headers["Precedence"] = "bulk"
+		headers["X-Auto-Response-Suppress"] = "OOF, AutoReply"
+	}
+
+	// Describe the build for mail rules and archival systems
+	if p.Config.DroneHeaders {
+		for name, value := range map[string]string{
+			"X-Drone-Repo":      p.Repo.FullName,
+			"X-Drone-Build":     strconv.Itoa(p.Build.Number),
+			"X-Drone-Status":    p.Build.Status,
+			"X-Drone-Event":     p.Build.Event,
+			"X-Drone-Branch":    p.Commit.Branch,
+			"X-Drone-Commit":    p.Commit.Sha,
+			"X-Drone-Deploy-To": p.DeployTo,
+		} {
+			if value != "" {
+				headers[name] = value
+			}
+		}
+	}
+
+	for name, value := range p.Config.CustomHeaders {
+		name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if reservedHeaders[name] {
+			log.Warnf("Not overriding the %s header with a custom header", name)
+			continue
+		}
+
+		value, err := renderInline(value, ctx)
+		if err != nil {
+			return nil, err
+		}
+		headers[name] = value
+	}
+
+	// Sender names the mailbox actually sending on behalf of the from
+	// address, e.g. for shared aliases
+	if p.Config.Sender != "" {
+		sender, err := netmail.ParseAddress(p.Config.Sender)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sender: %w", err)
+		}
+		headers["Sender"] = sender.String()
+	}
+
+	// List-Id identifies the notifications for filtering, e.g.
+	// CI <ci-notifications.repo.example>
+	if p.Config.ListID != "" {
+		id, err := renderInline(p.Config.ListID, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasSuffix(id, ">") {
+			id = "<" + id + ">"
+		}
+		headers["List-Id"] = id
+	}
+
+	// List-Unsubscribe lists mailto: and http(s) URLs to mute the
+	// notifications
+	var unsubscribe []string
+	for _, entry := range p.Config.ListUnsubscribe {
+		entry, err := renderInline(entry, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if entry == "" {
+			continue
+		}
+		unsubscribe = append(unsubscribe, "<"+strings.Trim(entry, "<>")+">")
+	}
+	if len(unsubscribe) > 0 {
+		headers["List-Unsubscribe"] = strings.Join(unsubscribe, ", ")
+	}
+
+	return headers, nil
+}
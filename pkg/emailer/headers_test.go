@@ -0,0 +1,75 @@
+package emailer
+
+import "testing"
+
+func TestCustomHeaders(t *testing.T) {
+	ctx := map[string]interface{}{
+		"repo":   map[string]interface{}{"name": "R&D <tools>"},
+		"commit": map[string]interface{}{"author": "O'Brien & Co"},
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   string
+	}{
+		{name: "plain", header: "X-Team", value: "Platform & Tools", want: "Platform & Tools"},
+		{name: "templated", header: "X-Environment", value: "{{ repo.name }} by {{ commit.author }}", want: "R&D <tools> by O'Brien & Co"},
+		{name: "reserved", header: "Message-Id", value: "<custom@example.com>"},
+		{name: "reserved threading", header: "References", value: "<custom@example.com>"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Plugin{Config: Config{CustomHeaders: map[string]string{test.header: test.value}}}
+			headers, err := p.headers(ctx)
+			if err != nil {
+				t.Fatalf("headers() error = %v", err)
+			}
+			if got := headers[test.header]; got != test.want {
+				t.Errorf("headers()[%s] = %q, want %q", test.header, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSenderIdentity(t *testing.T) {
+	ctx := map[string]interface{}{
+		"repo": map[string]interface{}{"name": "hello-world", "owner": "O'Brien & Co"},
+	}
+
+	tests := []struct {
+		name    string
+		config  Config
+		address string
+		from    string
+		replyTo string
+	}{
+		{
+			name:    "plain",
+			config:  Config{FromAddress: "ci@example.com", FromName: "Drone & CI"},
+			address: "ci@example.com",
+			from:    "Drone & CI",
+		},
+		{
+			name:    "templated",
+			config:  Config{FromAddress: "ci+{{ repo.name }}@example.com", FromName: "{{ repo.owner }} – {{ repo.name }}", ReplyTo: "{{ repo.name }}@example.com"},
+			address: "ci+hello-world@example.com",
+			from:    "O'Brien & Co – hello-world",
+			replyTo: "hello-world@example.com",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			address, from, replyTo, err := Plugin{Config: test.config}.senderIdentity(ctx)
+			if err != nil {
+				t.Fatalf("senderIdentity() error = %v", err)
+			}
+			if address != test.address || from != test.from || replyTo != test.replyTo {
+				t.Errorf("senderIdentity() = %q, %q, %q, want %q, %q, %q", address, from, replyTo, test.address, test.from, test.replyTo)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HistoryBuild is a previous build of the branch exposed to the templates
+type HistoryBuild struct {
+	Number   int
+	Status   string
+	Author   string
+	Duration string
+	Started  float64
+	Finished float64
+	Link     string
+}
+
+// history fetches the most recent builds of the current branch from the API.
+// Errors are logged and result in an empty history, as the history is purely
+// informational and should never prevent the notification from being sent.
+func (p Plugin) history(ctx context.Context) []HistoryBuild {
+	if p.Config.History <= 0 || p.Config.APIServer == "" {
+		return nil
+	}
+
+	client := newAPIClient(ctx, p.Config.APIServer, p.Config.APIToken)
+
+	// request one more build as the current one is part of the result
+	builds, err := client.builds(p.Repo.Owner, p.Repo.Name, p.Commit.Branch, p.Config.History+1)
+	if err != nil {
+		log.Warnf("Could not fetch build history: %v", err)
+		return nil
+	}
+
+	history := make([]HistoryBuild, 0, p.Config.History)
+	for _, build := range builds {
+		if build.Number == p.Build.Number {
+			continue
+		}
+		if len(history) == p.Config.History {
+			break
+		}
+
+		author := build.AuthorName
+		if author == "" {
+			author = build.AuthorLogin
+		}
+
+		var duration string
+		if build.Started != 0 && build.Finished != 0 {
+			duration = fmt.Sprint(time.Duration(build.Finished-build.Started) * time.Second)
+		}
+
+		history = append(history, HistoryBuild{
+			Number:   build.Number,
+			Status:   build.Status,
+			Author:   author,
+			Duration: duration,
+			Started:  float64(build.Started),
+			Finished: float64(build.Finished),
+			Link:     fmt.Sprintf("%s/%s/%s/%d", client.server, p.Repo.Owner, p.Repo.Name, build.Number),
+		})
+	}
+
+	return history
+}
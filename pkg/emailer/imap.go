@@ -0,0 +1,162 @@
+package emailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mail "github.com/wneessen/go-mail"
+)
+
+// imapTimeout limits every IMAP command
+const imapTimeout = 30 * time.Second
+
+// sentFolder appends sent messages to a mailbox of an IMAP server over a
+// single connection shared by all senders
+type sentFolder struct {
+	folder string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	tag    int
+}
+
+// openSentFolder logs in to the IMAP server configured for the copies of the
+// sent messages. It returns nil if no IMAP server is configured.
+func (p Plugin) openSentFolder(ctx context.Context) (*sentFolder, error) {
+	if p.Config.IMAPHost == "" {
+		return nil, nil
+	}
+
+	port := p.Config.IMAPPort
+	if port == 0 {
+		port = 993
+	}
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: imapTimeout},
+		Config: &tls.Config{
+			ServerName:         p.Config.IMAPHost,
+			InsecureSkipVerify: p.Config.SkipVerify, //nolint:gosec
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(p.Config.IMAPHost, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+
+	f := &sentFolder{
+		folder: p.Config.IMAPFolder,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+	if f.folder == "" {
+		f.folder = "CI Notifications"
+	}
+
+	// Use the SMTP credentials unless the mailbox has its own
+	username, password := p.Config.IMAPUsername, p.Config.IMAPPassword
+	if username == "" {
+		username, password = p.Config.Username, p.Config.Password
+	}
+
+	conn.SetDeadline(time.Now().Add(imapTimeout))
+	if greeting, err := f.reader.ReadString('\n'); err != nil {
+		conn.Close()
+		return nil, err
+	} else if !strings.HasPrefix(greeting, "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting %q", strings.TrimSpace(greeting))
+	}
+	if _, err := f.command(fmt.Sprintf("LOGIN %s %s", imapQuote(username), imapQuote(password)), nil); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not log in: %w", err)
+	}
+	return f, nil
+}
+
+// append stores a copy of the message in the folder, creating the folder if
+// it does not exist yet
+func (f *sentFolder) append(msg *mail.Msg) error {
+	if f == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if _, err := msg.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	command := fmt.Sprintf(`APPEND %s (\Seen) {%d}`, imapQuote(f.folder), buf.Len())
+	status, err := f.command(command, buf.Bytes())
+	if err != nil && strings.Contains(status, "[TRYCREATE]") {
+		if _, err := f.command("CREATE "+imapQuote(f.folder), nil); err != nil {
+			return fmt.Errorf("could not create folder %s: %w", f.folder, err)
+		}
+		_, err = f.command(command, buf.Bytes())
+	}
+	return err
+}
+
+// command sends the command, followed by the literal once the server asks
+// for it, and returns the tagged status line
+func (f *sentFolder) command(command string, literal []byte) (string, error) {
+	f.tag++
+	tag := fmt.Sprintf("a%d", f.tag)
+
+	f.conn.SetDeadline(time.Now().Add(imapTimeout))
+	if _, err := fmt.Fprintf(f.conn, "%s %s\r\n", tag, command); err != nil {
+		return "", err
+	}
+
+	for {
+		line, err := f.reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case strings.HasPrefix(line, "+") && literal != nil:
+			if _, err := f.conn.Write(literal); err != nil {
+				return "", err
+			}
+			if _, err := f.conn.Write([]byte("\r\n")); err != nil {
+				return "", err
+			}
+			literal = nil
+		case strings.HasPrefix(line, tag+" "):
+			status := strings.TrimPrefix(line, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return status, fmt.Errorf("%s", status)
+			}
+			return status, nil
+		}
+	}
+}
+
+// Close logs out and closes the connection
+func (f *sentFolder) Close() error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.command("LOGOUT", nil)
+	return f.conn.Close()
+}
+
+// imapQuote returns the string as IMAP quoted string
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,154 @@
+package emailer
+
+import (
+	"encoding/xml"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultSlowestTests is the number of slowest tests exposed to the templates
+const DefaultSlowestTests = 5
+
+type (
+	// TestReport is the summary of the parsed JUnit reports
+	TestReport struct {
+		Total    int
+		Passed   int
+		Failed   int
+		Errored  int
+		Skipped  int
+		Duration float64
+		Failures []TestCase
+		Slowest  []TestCase
+	}
+
+	// TestCase is a single test of the JUnit reports
+	TestCase struct {
+		Name      string
+		Classname string
+		Duration  float64
+		Message   string
+	}
+
+	junitSuite struct {
+		Suites []junitSuite `xml:"testsuite"`
+		Cases  []junitCase  `xml:"testcase"`
+	}
+
+	junitCase struct {
+		Name      string       `xml:"name,attr"`
+		Classname string       `xml:"classname,attr"`
+		Time      string       `xml:"time,attr"`
+		Failure   *junitResult `xml:"failure"`
+		Error     *junitResult `xml:"error"`
+		Skipped   *junitResult `xml:"skipped"`
+	}
+
+	junitResult struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// testReport parses the configured JUnit reports. Reports which can't be read
+// or parsed are logged and skipped.
+func (p Plugin) testReport() *TestReport {
+	if len(p.Config.JUnitReports) == 0 {
+		return nil
+	}
+
+	files, err := expandGlobs(p.Config.JUnitReports)
+	if err != nil {
+		log.Warnf("Could not expand JUnit report patterns: %v", err)
+		return nil
+	}
+	if len(files) == 0 {
+		log.Warnf("No JUnit reports found matching %v", p.Config.JUnitReports)
+		return nil
+	}
+
+	report := new(TestReport)
+	var cases []TestCase
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.Warnf("Could not read JUnit report %s: %v", file, err)
+			continue
+		}
+
+		var suite junitSuite
+		if err := xml.Unmarshal(data, &suite); err != nil {
+			log.Warnf("Could not parse JUnit report %s: %v", file, err)
+			continue
+		}
+
+		cases = append(cases, report.add(suite)...)
+	}
+
+	sort.SliceStable(cases, func(i, j int) bool {
+		return cases[i].Duration > cases[j].Duration
+	})
+	if len(cases) > DefaultSlowestTests {
+		cases = cases[:DefaultSlowestTests]
+	}
+	report.Slowest = cases
+
+	return report
+}
+
+// add adds the test cases of the suite and all nested suites to the report
+func (r *TestReport) add(suite junitSuite) []TestCase {
+	var cases []TestCase
+
+	for _, nested := range suite.Suites {
+		cases = append(cases, r.add(nested)...)
+	}
+
+	for _, c := range suite.Cases {
+		duration, _ := strconv.ParseFloat(c.Time, 64)
+		tc := TestCase{
+			Name:      c.Name,
+			Classname: c.Classname,
+			Duration:  duration,
+		}
+
+		r.Total++
+		r.Duration += duration
+
+		switch {
+		case c.Failure != nil:
+			r.Failed++
+			tc.Message = c.Failure.message()
+			r.Failures = append(r.Failures, tc)
+		case c.Error != nil:
+			r.Errored++
+			tc.Message = c.Error.message()
+			r.Failures = append(r.Failures, tc)
+		case c.Skipped != nil:
+			r.Skipped++
+		default:
+			r.Passed++
+		}
+
+		cases = append(cases, tc)
+	}
+
+	return cases
+}
+
+// message returns the message attribute or the first line of the text
+func (r junitResult) message() string {
+	if r.Message != "" {
+		return r.Message
+	}
+	text := strings.TrimSpace(r.Text)
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	return text
+}
@@ -0,0 +1,105 @@
+package emailer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	mail "github.com/wneessen/go-mail"
+)
+
+// keepaliveSender resets the connection when idle for the keepalive
+// interval, so the server does not drop it while the messages are prepared
+// or sending is delayed
+type keepaliveSender struct {
+	Sender
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// Send sends the messages, excluding the keepalive meanwhile
+func (s *keepaliveSender) Send(messages ...*mail.Msg) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.Sender.Send(messages...)
+	s.last = time.Now()
+	return err
+}
+
+// DialWithContext reconnects, excluding the keepalive meanwhile
+func (s *keepaliveSender) DialWithContext(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.Sender.DialWithContext(ctx)
+	s.last = time.Now()
+	return err
+}
+
+// Close closes the connection, excluding the keepalive meanwhile
+func (s *keepaliveSender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Sender.Close()
+}
+
+// keepalive resets the connection whenever it was idle for the interval
+// until the context is done. Senders not supporting a reset are left alone.
+func (s *keepaliveSender) keepalive(ctx context.Context, interval time.Duration) {
+	resetter, ok := s.Sender.(interface{ Reset() error })
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		if time.Since(s.last) >= interval {
+			if err := resetter.Reset(); err != nil {
+				log.Debugf("Keepalive failed: %v", err)
+			}
+			s.last = time.Now()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// connectionLost reports whether sending failed because the server closed
+// the connection, without replying or with 421
+func connectionLost(err error) bool {
+	code := replyCode(err)
+	return code == 0 || code == 421
+}
+
+// keepalive wraps the clients to keep their connections alive while idle,
+// until stop is called
+func (p Plugin) keepalive(clients []Sender) (wrapped []Sender, stop func()) {
+	if p.Config.Keepalive <= 0 {
+		return clients, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wrapped = make([]Sender, 0, len(clients))
+	for _, client := range clients {
+		sender := &keepaliveSender{Sender: client, last: time.Now()}
+		wrapped = append(wrapped, sender)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sender.keepalive(ctx, p.Config.Keepalive)
+		}()
+	}
+	return wrapped, func() {
+		cancel()
+		wg.Wait()
+	}
+}
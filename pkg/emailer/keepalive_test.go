@@ -0,0 +1,48 @@
+package emailer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mail "github.com/wneessen/go-mail"
+)
+
+// connSender tracks the state of its connection without synchronization,
+// so the race detector reports concurrent use
+type connSender struct {
+	open   bool
+	resets int
+}
+
+func (s *connSender) DialWithContext(context.Context) error { s.open = true; return nil }
+func (s *connSender) Send(...*mail.Msg) error               { return nil }
+func (s *connSender) Close() error                          { s.open = false; return nil }
+func (s *connSender) Reset() error {
+	if !s.open {
+		return errors.New("connection closed")
+	}
+	s.resets++
+	return nil
+}
+
+func TestKeepaliveExclusive(t *testing.T) {
+	client := &connSender{open: true}
+	p := Plugin{Config: Config{Keepalive: time.Millisecond}}
+	clients, stop := p.keepalive([]Sender{client})
+
+	// Reconnect like the deliver loop does after a retry delay while the
+	// keepalive resets the idle connection
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		clients[0].Close()
+		clients[0].DialWithContext(context.Background())
+		time.Sleep(2 * time.Millisecond)
+	}
+	stop()
+
+	if client.resets == 0 {
+		t.Error("keepalive did not reset the idle connection")
+	}
+}
@@ -0,0 +1,60 @@
+package emailer
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	maillog "github.com/wneessen/go-mail/log"
+)
+
+// Output formats of the log
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// ConfigureLogging sets the format and level of the log output
+func ConfigureLogging(format, level string) error {
+	switch strings.ToLower(format) {
+	case "", LogFormatText:
+	case LogFormatJSON:
+		log.SetFormatter(&log.JSONFormatter{
+			FieldMap: log.FieldMap{
+				log.FieldKeyTime:  "time",
+				log.FieldKeyLevel: "level",
+				log.FieldKeyMsg:   "message",
+			},
+		})
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	if level == "" {
+		return nil
+	}
+	parsed, err := log.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	log.SetLevel(parsed)
+	return nil
+}
+
+// smtpLogger writes the SMTP conversation logged by the mail client to the
+// log output, where secrets are redacted
+type smtpLogger struct{}
+
+func (smtpLogger) Debugf(l maillog.Log) { smtpLog(l).Info(fmt.Sprintf(l.Format, l.Messages...)) }
+func (smtpLogger) Infof(l maillog.Log)  { smtpLog(l).Info(fmt.Sprintf(l.Format, l.Messages...)) }
+func (smtpLogger) Warnf(l maillog.Log)  { smtpLog(l).Warn(fmt.Sprintf(l.Format, l.Messages...)) }
+func (smtpLogger) Errorf(l maillog.Log) { smtpLog(l).Error(fmt.Sprintf(l.Format, l.Messages...)) }
+
+// smtpLog returns the log entry prefixed with the direction of the message
+func smtpLog(l maillog.Log) *log.Entry {
+	direction := "server"
+	if l.Direction == maillog.DirClientToServer {
+		direction = "client"
+	}
+	return log.WithField("smtp", direction)
+}
@@ -0,0 +1,142 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// stepLog is the log output of a single failed step
+type stepLog struct {
+	Stage   string
+	Step    string
+	Content string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// failedLogs fetches the logs of all failed steps of the current build from
+// the API. Errors are logged and skipped so a missing log never prevents the
+// notification from being sent.
+func (p Plugin) failedLogs(ctx context.Context) []stepLog {
+	if p.Config.APIServer == "" || p.Build.Status != "failure" {
+		return nil
+	}
+
+	client := newAPIClient(ctx, p.Config.APIServer, p.Config.APIToken)
+
+	build, err := client.build(p.Repo.Owner, p.Repo.Name, p.Build.Number)
+	if err != nil {
+		log.Warnf("Could not fetch build %d: %v", p.Build.Number, err)
+		return nil
+	}
+
+	var logs []stepLog
+	for _, stage := range build.Stages {
+		for _, step := range stage.Steps {
+			if step.Status != "failure" && step.Status != "error" {
+				continue
+			}
+
+			lines, err := client.logs(p.Repo.Owner, p.Repo.Name, p.Build.Number, stage.Number, step.Number)
+			if err != nil {
+				log.Warnf("Could not fetch logs of step %s/%s: %v", stage.Name, step.Name, err)
+				continue
+			}
+
+			var content strings.Builder
+			for _, line := range lines {
+				content.WriteString(line.Out)
+			}
+
+			logs = append(logs, stepLog{
+				Stage:   stage.Name,
+				Step:    step.Name,
+				Content: content.String(),
+			})
+		}
+	}
+
+	return logs
+}
+
+// logAttachments converts the logs of the failed steps to attachments,
+// optionally gzip compressed
+func (p Plugin) logAttachments(logs []stepLog) []attachment {
+	attachments := make([]attachment, 0, len(logs))
+	for _, l := range logs {
+		name := fmt.Sprintf("%s-%s.log",
+			unsafeFileChars.ReplaceAllString(l.Stage, "-"),
+			unsafeFileChars.ReplaceAllString(l.Step, "-"),
+		)
+		data := []byte(l.Content)
+
+		if p.Config.AttachLogsGzip {
+			compressed, err := gzipBytes(data)
+			if err != nil {
+				log.Warnf("Could not compress log %s: %v", name, err)
+				continue
+			}
+			name, data = name+".gz", compressed
+		}
+
+		attachments = append(attachments, attachment{Name: name, Data: data})
+	}
+
+	return attachments
+}
+
+// Logs exposes the log output of the failed steps to the templates. The logs
+// are only loaded once they are used by a template.
+type Logs struct {
+	once sync.Once
+	load func() string
+	text string
+}
+
+// Text returns the complete log output
+func (l *Logs) Text() string {
+	l.once.Do(func() {
+		if l.load != nil {
+			l.text = l.load()
+		}
+	})
+	return l.text
+}
+
+// Tail returns the last n lines of the log output
+func (l *Logs) Tail(n int) string {
+	lines := strings.Split(strings.TrimRight(l.Text(), "\n"), "\n")
+	if n >= 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// newLogs returns the logs exposed to the templates, read from the configured
+// log file or otherwise from the failed steps fetched from the API
+func (p Plugin) newLogs(failed func() []stepLog) *Logs {
+	return &Logs{
+		load: func() string {
+			if p.Config.LogFile != "" {
+				data, err := os.ReadFile(p.Config.LogFile)
+				if err != nil {
+					log.Warnf("Could not read log file %s: %v", p.Config.LogFile, err)
+					return ""
+				}
+				return string(data)
+			}
+
+			var text strings.Builder
+			for _, l := range failed() {
+				text.WriteString(l.Content)
+			}
+			return text.String()
+		},
+	}
+}
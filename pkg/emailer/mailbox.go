@@ -0,0 +1,129 @@
+package emailer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	mail "github.com/wneessen/go-mail"
+)
+
+// Formats of the local mailbox the sent messages are written to
+const (
+	MailboxMbox    = "mbox"
+	MailboxMaildir = "maildir"
+)
+
+// mboxFromLine matches the body lines escaped in mbox files, as they would
+// otherwise start a new message
+var mboxFromLine = regexp.MustCompile(`(?m)^(>*From )`)
+
+// localMailbox writes sent messages to an mbox file or a Maildir
+type localMailbox struct {
+	path   string
+	format string
+
+	mu       sync.Mutex
+	hostname string
+	count    int
+}
+
+// openMailbox prepares the configured mbox file or Maildir. It returns nil
+// if no mailbox is configured.
+func (p Plugin) openMailbox() (*localMailbox, error) {
+	if p.Config.MailboxPath == "" {
+		return nil, nil
+	}
+
+	m := &localMailbox{
+		path:   p.Config.MailboxPath,
+		format: p.Config.MailboxFormat,
+	}
+	switch m.format {
+	case "", MailboxMbox:
+		m.format = MailboxMbox
+		if err := os.MkdirAll(filepath.Dir(m.path), 0o755); err != nil {
+			return nil, err
+		}
+	case MailboxMaildir:
+		for _, dir := range []string{"tmp", "new", "cur"} {
+			if err := os.MkdirAll(filepath.Join(m.path, dir), 0o755); err != nil {
+				return nil, err
+			}
+		}
+		m.hostname, _ = os.Hostname()
+		if m.hostname == "" {
+			m.hostname = "localhost"
+		}
+		m.hostname = unsafeFileChars.ReplaceAllString(m.hostname, "-")
+	default:
+		return nil, fmt.Errorf("unknown mailbox format %q", m.format)
+	}
+	return m, nil
+}
+
+// write adds the message to the mailbox
+func (m *localMailbox) write(msg *mail.Msg) error {
+	if m == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if _, err := msg.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.format == MailboxMaildir {
+		return m.writeMaildir(buf.Bytes())
+	}
+	return m.writeMbox(msg, buf.Bytes())
+}
+
+// writeMbox appends the message to the mbox file in a single write, so
+// messages of concurrent builds are not interleaved
+func (m *localMailbox) writeMbox(msg *mail.Msg, raw []byte) error {
+	from, err := msg.GetSender(false)
+	if err != nil {
+		from = "MAILER-DAEMON"
+	}
+	from = strings.Trim(from, "<>")
+
+	raw = bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n"))
+	raw = mboxFromLine.ReplaceAll(raw, []byte(">$1"))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From %s %s\n", from, time.Now().UTC().Format(time.ANSIC))
+	buf.Write(bytes.TrimRight(raw, "\n"))
+	buf.WriteString("\n\n")
+
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeMaildir delivers the message to the new directory of the Maildir,
+// writing it to tmp first so readers never see a partial message
+func (m *localMailbox) writeMaildir(raw []byte) error {
+	m.count++
+	name := fmt.Sprintf("%d.P%dQ%d.%s", time.Now().UnixNano(), os.Getpid(), m.count, m.hostname)
+
+	tmp := filepath.Join(m.path, "tmp", name)
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(m.path, "new", name))
+}
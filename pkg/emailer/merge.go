@@ -0,0 +1,112 @@
+package emailer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// fileRecipient is a recipient listed in the recipients file with the
+// variables exposed to the templates as recipient
+type fileRecipient struct {
+	Address   string
+	Variables map[string]string
+}
+
+// structuredRecipientsFile reports whether the recipients file is a YAML or
+// JSON list instead of a text file with one address per line
+func structuredRecipientsFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yml", ".yaml", ".json":
+		return true
+	}
+	return false
+}
+
+// readRecipientsFile reads the recipients file. Structured files list
+// either addresses or mappings of the email address and the variables of
+// the recipient.
+func readRecipientsFile(name string) ([]fileRecipient, error) {
+	if !structuredRecipientsFile(name) {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		var recipients []fileRecipient
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			recipient := scanner.Text()
+			if recipient == "" {
+				log.Warnf("Skipping empty recipient from file %s", name)
+				continue
+			}
+			recipients = append(recipients, fileRecipient{Address: recipient})
+		}
+		return recipients, scanner.Err()
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML
+	var entries []interface{}
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", name, err)
+	}
+
+	recipients := make([]fileRecipient, 0, len(entries))
+	for i, entry := range entries {
+		switch entry := entry.(type) {
+		case string:
+			recipients = append(recipients, fileRecipient{Address: entry})
+		case map[string]interface{}:
+			variables := make(map[string]string, len(entry))
+			for key, value := range entry {
+				if value != nil {
+					variables[key] = fmt.Sprint(value)
+				}
+			}
+			if variables["email"] == "" {
+				log.Warnf("Skipping recipient %d without email from file %s", i+1, name)
+				continue
+			}
+			recipients = append(recipients, fileRecipient{
+				Address:   variables["email"],
+				Variables: variables,
+			})
+		default:
+			log.Warnf("Skipping recipient %d from file %s, expected an address or a mapping", i+1, name)
+		}
+	}
+	return recipients, nil
+}
+
+// recipientVariables returns the variables of the recipients listed in a
+// structured recipients file by address
+func (p Plugin) recipientVariables() map[string]map[string]string {
+	if p.Resolver != nil || !structuredRecipientsFile(p.Config.RecipientsFile) {
+		return nil
+	}
+
+	recipients, err := readRecipientsFile(p.Config.RecipientsFile)
+	if err != nil {
+		return nil
+	}
+
+	variables := make(map[string]map[string]string)
+	for _, recipient := range recipients {
+		if len(recipient.Variables) > 0 {
+			variables[recipient.Address] = recipient.Variables
+		}
+	}
+	return variables
+}
@@ -0,0 +1,399 @@
+package emailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"maps"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	mail "github.com/wneessen/go-mail"
+)
+
+// Formats of the message body
+const (
+	FormatMultipart = "multipart"
+	FormatText      = "text"
+	FormatHTML      = "html"
+)
+
+// unsafeVERPChars are replaced in the tag of VERP addresses
+var unsafeVERPChars = regexp.MustCompile(`[^A-Za-z0-9._=-]+`)
+
+// transferEncodings are the supported Content-Transfer-Encoding values
+var transferEncodings = map[string]mail.Encoding{
+	"quoted-printable": mail.EncodingQP,
+	"base64":           mail.EncodingB64,
+	"8bit":             mail.NoEncoding,
+}
+
+// transferEncoding returns the encoding named by the setting or the given
+// default if unset
+func transferEncoding(name string, fallback mail.Encoding) (mail.Encoding, error) {
+	if name == "" {
+		return fallback, nil
+	}
+
+	encoding, ok := transferEncodings[strings.ToLower(name)]
+	if !ok {
+		return "", fmt.Errorf("unknown transfer encoding %q", name)
+	}
+	return encoding, nil
+}
+
+// encodings returns the transfer encodings of the bodies and attachments.
+// Unencoded 8-bit data is replaced by quoted-printable bodies and base64
+// attachments if 7-bit is forced.
+func (p Plugin) encodings() (body, attachments mail.Encoding, err error) {
+	body, err = transferEncoding(p.Config.BodyEncoding, mail.EncodingQP)
+	if err != nil {
+		return "", "", err
+	}
+	attachments, err = transferEncoding(p.Config.AttachmentEncoding, mail.EncodingB64)
+	if err != nil {
+		return "", "", err
+	}
+	if attachments == mail.EncodingQP {
+		return "", "", fmt.Errorf("attachments can't be encoded as quoted-printable")
+	}
+
+	if p.Config.Force7Bit {
+		if body == mail.NoEncoding {
+			body = mail.EncodingQP
+		}
+		if attachments == mail.NoEncoding {
+			attachments = mail.EncodingB64
+		}
+	}
+	return body, attachments, nil
+}
+
+// message is the rendered content shared by the messages of all recipients
+type message struct {
+	Subject     string
+	HTML        string
+	Text        string
+	Headers     map[string]string
+	Importance  mail.Importance
+	Thread      *thread
+	ReadReceipt []string
+	SMIME       *tls.Certificate
+	PGP         *pgpKeys
+	Attachments []attachment
+
+	// Personalized is the content rendered for the recipients with
+	// variables, by recipient
+	Personalized map[string]personalized
+}
+
+// personalized is the content rendered with the variables of a recipient
+type personalized struct {
+	Subject string
+	HTML    string
+	Text    string
+	Headers map[string]string
+}
+
+// forRecipient returns the message with the content personalized for the
+// recipient, if any
+func (m message) forRecipient(recipient string) message {
+	if content, ok := m.Personalized[recipient]; ok {
+		m.Subject = content.Subject
+		m.HTML = content.HTML
+		m.Text = content.Text
+		m.Headers = content.Headers
+	}
+	return m
+}
+
+// newMessage builds the message sent to a single recipient
+func (p Plugin) newMessage(recipient string, m message) (*mail.Msg, error) {
+	m = m.forRecipient(recipient)
+
+	bodyEncoding, attachmentEncoding, err := p.encodings()
+	if err != nil {
+		return nil, err
+	}
+	charset, err := p.charset()
+	if err != nil {
+		return nil, err
+	}
+
+	msg := mail.NewMsg(mail.WithEncoding(bodyEncoding), mail.WithCharset(charset.name))
+
+	// Identify the build of the plugin that produced the message
+	msg.SetUserAgent(ReadBuildInfo().UserAgent())
+
+	// Set From header with optional name
+	if p.Config.FromName != "" {
+		if err := msg.FromFormat(charset.text(p.Config.FromName), p.Config.FromAddress); err != nil {
+			log.Errorf("Could not set From header: %v", err)
+			return nil, err
+		}
+	} else {
+		if err := msg.From(p.Config.FromAddress); err != nil {
+			log.Errorf("Could not set From header: %v", err)
+			return nil, err
+		}
+	}
+
+	// Set the envelope sender receiving bounces
+	if envelopeFrom, err := p.envelopeFrom(recipient); err != nil {
+		log.Errorf("Could not set envelope from address: %v", err)
+		return nil, err
+	} else if envelopeFrom != "" {
+		if err := msg.EnvelopeFrom(envelopeFrom); err != nil {
+			log.Errorf("Could not set envelope from address: %v", err)
+			return nil, err
+		}
+	}
+
+	// Set Reply-To header, skipped if rendered empty e.g. for a missing
+	// commit author email
+	if p.Config.ReplyTo != "" {
+		if err := msg.ReplyTo(p.Config.ReplyTo); err != nil {
+			log.Errorf("Could not set Reply-To header: %v", err)
+			return nil, err
+		}
+	}
+
+	// Set To header
+	if err := msg.To(recipient); err != nil {
+		log.Errorf("Could not set To header: %v", err)
+		return nil, err
+	}
+
+	// Set Subject
+	msg.Subject(charset.text(m.Subject))
+
+	// Reference the thread root to group the notifications
+	if m.Thread != nil {
+		msg.SetMessageIDWithValue(m.Thread.MessageID)
+		msg.SetGenHeader(mail.HeaderInReplyTo, "<"+m.Thread.Root+">")
+		msg.SetGenHeader(mail.HeaderReferences, "<"+m.Thread.Root+">")
+	} else if id := p.messageID(); id != "" {
+		msg.SetMessageIDWithValue(id)
+	}
+
+	// Request read receipts
+	if len(m.ReadReceipt) > 0 {
+		if err := msg.RequestMDNTo(m.ReadReceipt...); err != nil {
+			log.Errorf("Could not set Disposition-Notification-To header: %v", err)
+			return nil, err
+		}
+	}
+
+	// Set the priority headers
+	msg.SetImportance(m.Importance)
+
+	// Set additional headers
+	for name, value := range m.Headers {
+		msg.SetGenHeader(mail.Header(name), value)
+	}
+
+	// Set body with plain text and HTML alternatives, or either only
+	switch {
+	case m.HTML == "":
+		msg.SetBodyString(mail.TypeTextPlain, charset.text(m.Text))
+	case m.Text == "":
+		msg.SetBodyString(mail.TypeTextHTML, charset.html(m.HTML))
+	default:
+		msg.SetBodyString(mail.TypeTextPlain, charset.text(m.Text))
+		msg.AddAlternativeString(mail.TypeTextHTML, charset.html(m.HTML))
+	}
+
+	// Add attachments
+	for _, a := range m.Attachments {
+		if err := a.attachTo(msg, attachmentEncoding); err != nil {
+			log.Errorf("Could not attach %s: %v", a.Name, err)
+			return nil, err
+		}
+	}
+
+	// Encrypt the message with the PGP key of the recipient
+	if m.PGP != nil {
+		encrypted, err := m.PGP.encrypt(msg, recipient)
+		if err != nil {
+			log.Errorf("Could not encrypt message to %s: %v", p.logRecipient(recipient), err)
+			return nil, err
+		}
+		if !encrypted {
+			log.Infof("Sending unencrypted message to %s without PGP key", p.logRecipient(recipient))
+		}
+	}
+
+	// Sign the message with S/MIME
+	if m.SMIME != nil {
+		if err := msg.SignWithTLSCertificate(m.SMIME); err != nil {
+			log.Errorf("Could not sign message: %v", err)
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
+
+// envelopeFrom returns the envelope sender of the message to the recipient.
+// With VERP the repository, build number and recipient are encoded into the
+// address, e.g. bounce+octocat-hello-world-42-jane=example.com@example.org,
+// so bounces identify the failing recipient.
+func (p Plugin) envelopeFrom(recipient string) (string, error) {
+	if p.Config.VERP == "" {
+		return p.Config.EnvelopeFrom, nil
+	}
+
+	local, domain, ok := strings.Cut(p.Config.VERP, "@")
+	if !ok {
+		return "", fmt.Errorf("invalid verp address %q", p.Config.VERP)
+	}
+
+	if address, err := netmail.ParseAddress(recipient); err == nil {
+		recipient = address.Address
+	}
+	tag := fmt.Sprintf("%s-%d-%s", p.Repo.FullName, p.Build.Number, strings.Replace(recipient, "@", "=", 1))
+	tag = unsafeVERPChars.ReplaceAllString(tag, "-")
+
+	return fmt.Sprintf("%s+%s@%s", local, tag, domain), nil
+}
+
+// withSkippedNote returns the message with a note about the skipped
+// attachments added to the bodies
+func (m message) withSkippedNote(skipped []attachment) message {
+	if len(skipped) == 0 {
+		return m
+	}
+
+	return m.withNote(skippedNote(skipped))
+}
+
+// withNote returns the message with the notes added to the HTML and plain
+// text body
+func (m message) withNote(htmlNote, textNote string) message {
+	m.HTML, m.Text = addNote(m.HTML, m.Text, htmlNote, textNote)
+
+	personalized := make(map[string]personalized, len(m.Personalized))
+	for recipient, content := range m.Personalized {
+		content.HTML, content.Text = addNote(content.HTML, content.Text, htmlNote, textNote)
+		personalized[recipient] = content
+	}
+	m.Personalized = personalized
+	return m
+}
+
+// addNote adds the notes to the HTML and plain text body, leaving out the
+// body not sent in text or html format
+func addNote(html, text, htmlNote, textNote string) (string, string) {
+	if html != "" {
+		html = appendHTML(html, htmlNote)
+	}
+	if text != "" {
+		text += "\n\n" + textNote
+	}
+	return html, text
+}
+
+// messageSize returns the size of the complete MIME message in bytes
+func (p Plugin) messageSize(recipient string, m message) (int64, error) {
+	msg, err := p.newMessage(recipient, m)
+	if err != nil {
+		return 0, err
+	}
+	return msg.WriteTo(io.Discard)
+}
+
+// dryRun builds the messages to all recipients and logs them instead of
+// sending them
+func (p Plugin) dryRun(recipients map[string]struct{}, m message) error {
+	log.Infof("Dry run, not sending any messages")
+	log.Infof("Subject: %s", m.Subject)
+	log.Infof("Body: %d bytes HTML, %d bytes plain text", len(m.HTML), len(m.Text))
+	for _, a := range m.Attachments {
+		log.Infof("Attachment: %s (%d bytes)", a.Name, a.size())
+	}
+
+	for recipient := range recipients {
+		msg, err := p.newMessage(recipient, m)
+		if err != nil {
+			return err
+		}
+		if err := p.writeMessage(recipient, msg); err != nil {
+			return err
+		}
+		size, err := msg.WriteTo(io.Discard)
+		if err != nil {
+			return err
+		}
+		log.Infof("Message to %s: %d bytes", p.logRecipient(recipient), size)
+	}
+	return nil
+}
+
+// Formats of the message preview
+const (
+	PreviewHTML = "html"
+	PreviewText = "text"
+	PreviewEML  = "eml"
+)
+
+// preview writes the rendered message in the configured format instead of
+// sending it. The message is written for the first recipient.
+func (p Plugin) preview(w io.Writer, recipients map[string]struct{}, m message) error {
+	var first string
+	if len(recipients) > 0 {
+		first = slices.Min(slices.Collect(maps.Keys(recipients)))
+		m = m.forRecipient(first)
+	}
+
+	switch p.Config.Preview {
+	case PreviewHTML:
+		_, err := io.WriteString(w, m.HTML)
+		return err
+	case PreviewText:
+		_, err := io.WriteString(w, m.Text)
+		return err
+	case PreviewEML:
+		if len(recipients) == 0 {
+			return fmt.Errorf("no recipient to preview the message for")
+		}
+		msg, err := p.newMessage(first, m)
+		if err != nil {
+			return err
+		}
+		_, err = msg.WriteTo(w)
+		return err
+	default:
+		return fmt.Errorf("unknown preview format %q", p.Config.Preview)
+	}
+}
+
+// writeMessage saves the message to the recipient as .eml file to the
+// output directory, if configured
+func (p Plugin) writeMessage(recipient string, msg *mail.Msg) error {
+	if p.Config.OutputDir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(p.Config.OutputDir, 0o755); err != nil {
+		return err
+	}
+
+	name := filepath.Join(p.Config.OutputDir, emlName(recipient))
+	if err := msg.WriteToFile(name); err != nil {
+		return fmt.Errorf("could not write message to %s: %w", name, err)
+	}
+	return nil
+}
+
+// emlName returns the file name of the message to the recipient
+func emlName(recipient string) string {
+	if address, err := netmail.ParseAddress(recipient); err == nil {
+		recipient = address.Address
+	}
+	return unsafeFileChars.ReplaceAllString(recipient, "-") + ".eml"
+}
@@ -0,0 +1,65 @@
+package emailer
+
+import "testing"
+
+func TestEnvelopeFrom(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    Config
+		recipient string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "default",
+			recipient: "jane@example.com",
+			want:      "",
+		},
+		{
+			name:      "envelope from",
+			config:    Config{EnvelopeFrom: "bounces@example.org"},
+			recipient: "jane@example.com",
+			want:      "bounces@example.org",
+		},
+		{
+			name:      "verp",
+			config:    Config{VERP: "bounce@example.org"},
+			recipient: "jane@example.com",
+			want:      "bounce+octocat-hello-world-42-jane=example.com@example.org",
+		},
+		{
+			name:      "verp with display name",
+			config:    Config{VERP: "bounce@example.org"},
+			recipient: "Jane Doe <jane@example.com>",
+			want:      "bounce+octocat-hello-world-42-jane=example.com@example.org",
+		},
+		{
+			name:      "verp unsafe characters",
+			config:    Config{VERP: "bounce@example.org"},
+			recipient: "jane+ci@example.com",
+			want:      "bounce+octocat-hello-world-42-jane-ci=example.com@example.org",
+		},
+		{
+			name:      "invalid verp",
+			config:    Config{VERP: "bounce"},
+			recipient: "jane@example.com",
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Plugin{Config: test.config}
+			p.Repo.FullName = "octocat/hello-world"
+			p.Build.Number = 42
+
+			got, err := p.envelopeFrom(test.recipient)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("envelopeFrom() error = %v, want error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("envelopeFrom() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package emailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// metricsPrefix is the prefix of all metric names
+const metricsPrefix = "drone_email"
+
+// deliveryMetrics counts the delivery of the messages of a single run
+type deliveryMetrics struct {
+	Attempted int
+	Sent      int
+	Bytes     int64
+	Latency   time.Duration
+}
+
+// pushMetrics sends the delivery metrics to the configured Prometheus
+// Pushgateway (http and https URLs) or StatsD server (udp URLs)
+func (p Plugin) pushMetrics(m deliveryMetrics) error {
+	if p.Config.MetricsURL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(p.Config.MetricsURL)
+	if err != nil {
+		return fmt.Errorf("invalid metrics url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return p.pushGateway(u, m)
+	case "udp", "statsd":
+		return p.pushStatsD(u, m)
+	default:
+		return fmt.Errorf("unsupported metrics url scheme %q", u.Scheme)
+	}
+}
+
+// pushGateway replaces the metrics of the repository group on the
+// Pushgateway
+func (p Plugin) pushGateway(u *url.URL, m deliveryMetrics) error {
+	labels := fmt.Sprintf(`{repo=%q,status=%q}`, p.Repo.FullName, p.Build.Status)
+
+	var body bytes.Buffer
+	for _, metric := range []struct {
+		name, kind, help string
+		value            any
+	}{
+		{"messages_attempted", "gauge", "Messages attempted to send", m.Attempted},
+		{"messages_sent", "gauge", "Messages accepted by the SMTP server", m.Sent},
+		{"messages_failed", "gauge", "Messages not accepted by the SMTP server", m.Attempted - m.Sent},
+		{"sent_bytes", "gauge", "Size of the sent messages", m.Bytes},
+		{"smtp_latency_seconds", "gauge", "Time spent sending to the SMTP server", m.Latency.Seconds()},
+		{"last_run_timestamp_seconds", "gauge", "Time of the last run", time.Now().Unix()},
+	} {
+		name := metricsPrefix + "_" + metric.name
+		fmt.Fprintf(&body, "# HELP %s %s\n# TYPE %s %s\n%s%s %v\n", name, metric.help, name, metric.kind, name, labels, metric.value)
+	}
+
+	u = u.JoinPath("metrics", "job", metricsPrefix, "repo@base64", base64.RawURLEncoding.EncodeToString([]byte(p.Repo.FullName)))
+	req, err := http.NewRequest(http.MethodPut, u.String(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	res, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("pushgateway responded with %s", res.Status)
+	}
+	return nil
+}
+
+// pushStatsD sends the metrics as StatsD packet, with the repository and
+// build status as DogStatsD tags
+func (p Plugin) pushStatsD(u *url.URL, m deliveryMetrics) error {
+	tags := "|#repo:" + p.Repo.FullName + ",status:" + p.Build.Status
+
+	var lines []string
+	for _, metric := range []struct {
+		name  string
+		value any
+		kind  string
+	}{
+		{"messages.attempted", m.Attempted, "c"},
+		{"messages.sent", m.Sent, "c"},
+		{"messages.failed", m.Attempted - m.Sent, "c"},
+		{"sent_bytes", m.Bytes, "c"},
+		{"smtp_latency", m.Latency.Milliseconds(), "ms"},
+	} {
+		lines = append(lines, fmt.Sprintf("%s.%s:%v|%s%s", metricsPrefix, metric.name, metric.value, metric.kind, tags))
+	}
+
+	conn, err := net.DialTimeout("udp", u.Host, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(strings.Join(lines, "\n")))
+	return err
+}
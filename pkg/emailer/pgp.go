@@ -0,0 +1,157 @@
+package emailer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	mail "github.com/wneessen/go-mail"
+)
+
+// pgpKeys holds the public keys of the recipients by email address and the
+// optional key messages are signed with
+type pgpKeys struct {
+	Keys   map[string]*openpgp.Entity
+	Signer *openpgp.Entity
+}
+
+// pgpKeys loads the public keys of the configured keyring, which is either a
+// file or a directory of files holding armored or binary keys. It returns nil
+// if PGP encryption is not configured.
+func (p Plugin) pgpKeys() (*pgpKeys, error) {
+	if p.Config.PGPKeyring == "" {
+		return nil, nil
+	}
+
+	files := []string{p.Config.PGPKeyring}
+	if info, err := os.Stat(p.Config.PGPKeyring); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		entries, err := os.ReadDir(p.Config.PGPKeyring)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				files = append(files, filepath.Join(p.Config.PGPKeyring, entry.Name()))
+			}
+		}
+	}
+
+	keys := &pgpKeys{Keys: make(map[string]*openpgp.Entity)}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		entities, err := readKeyRing(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not read keys from %s: %w", file, err)
+		}
+		for _, entity := range entities {
+			for _, identity := range entity.Identities {
+				if identity.UserId != nil && identity.UserId.Email != "" {
+					keys.Keys[strings.ToLower(identity.UserId.Email)] = entity
+				}
+			}
+		}
+	}
+
+	if p.Config.PGPSigningKey != "" {
+		data, err := readSecret(p.Config.PGPSigningKey)
+		if err != nil {
+			return nil, err
+		}
+		entities, err := readKeyRing(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not read signing key: %w", err)
+		}
+		if len(entities) == 0 || entities[0].PrivateKey == nil {
+			return nil, fmt.Errorf("signing key contains no private key")
+		}
+		signer := entities[0]
+		if signer.PrivateKey.Encrypted {
+			if err := signer.DecryptPrivateKeys([]byte(p.Config.PGPPassphrase)); err != nil {
+				return nil, fmt.Errorf("could not decrypt signing key: %w", err)
+			}
+		}
+		keys.Signer = signer
+	}
+
+	return keys, nil
+}
+
+// readKeyRing reads armored or binary keys
+func readKeyRing(data []byte) (openpgp.EntityList, error) {
+	if bytes.Contains(data, []byte("-----BEGIN PGP")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+// encrypt replaces the content of the message with its PGP/MIME encrypted
+// form if a key of the recipient exists and reports whether it did. The
+// headers besides the content headers stay unencrypted.
+func (k *pgpKeys) encrypt(msg *mail.Msg, recipient string) (bool, error) {
+	if address, err := netmail.ParseAddress(recipient); err == nil {
+		recipient = address.Address
+	}
+	key, ok := k.Keys[strings.ToLower(recipient)]
+	if !ok {
+		return false, nil
+	}
+
+	var raw bytes.Buffer
+	if _, err := msg.WriteTo(&raw); err != nil {
+		return false, err
+	}
+
+	// The encrypted entity consists of the content headers and the body
+	header, body, _ := strings.Cut(raw.String(), "\r\n\r\n")
+	var entity strings.Builder
+	content := false
+	for _, line := range strings.Split(header, "\r\n") {
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			content = strings.HasPrefix(strings.ToLower(line), "content-")
+		}
+		if content {
+			entity.WriteString(line + "\r\n")
+		}
+	}
+	entity.WriteString("\r\n" + body)
+
+	var encrypted bytes.Buffer
+	armored, err := armor.Encode(&encrypted, "PGP MESSAGE", nil)
+	if err != nil {
+		return false, err
+	}
+	plaintext, err := openpgp.Encrypt(armored, []*openpgp.Entity{key}, k.Signer, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.WriteString(plaintext, entity.String()); err != nil {
+		return false, err
+	}
+	if err := plaintext.Close(); err != nil {
+		return false, err
+	}
+	if err := armored.Close(); err != nil {
+		return false, err
+	}
+
+	msg.UnsetAllParts()
+	msg.UnsetAllAttachments()
+	msg.UnsetAllEmbeds()
+	msg.SetPGPType(mail.PGPEncrypt)
+	msg.SetBodyString("application/pgp-encrypted", "Version: 1", mail.WithPartEncoding(mail.NoEncoding))
+	msg.AddAlternativeString(`application/octet-stream; name="encrypted.asc"`, encrypted.String(), mail.WithPartEncoding(mail.NoEncoding))
+
+	return true, nil
+}
@@ -0,0 +1,140 @@
+package emailer
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jaytaylor/html2text"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Styles of the links in the plain text body converted from HTML
+const (
+	TextLinksInline    = "inline"
+	TextLinksFootnotes = "footnotes"
+	TextLinksOmit      = "omit"
+)
+
+// Styles of the tables in the plain text body converted from HTML
+const (
+	TextTablesPlain  = "plain"
+	TextTablesPretty = "pretty"
+)
+
+// htmlToText converts the HTML body to the plain text alternative with the
+// configured link and table styles, wrapped at the configured width
+func (p Plugin) htmlToText(body string) (string, error) {
+	var links []string
+	if p.Config.TextLinks == TextLinksFootnotes {
+		var err error
+		if body, links, err = footnoteLinks(body); err != nil {
+			return "", err
+		}
+	}
+
+	text, err := html2text.FromString(body, html2text.Options{
+		PrettyTables: p.Config.TextTables == TextTablesPretty,
+		OmitLinks:    p.Config.TextLinks == TextLinksOmit,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(links) > 0 {
+		text += "\n\n"
+		for i, link := range links {
+			text += fmt.Sprintf("[%d] %s\n", i+1, link)
+		}
+		text = strings.TrimRight(text, "\n")
+	}
+	if p.Config.TextWidth > 0 {
+		text = wrapText(text, p.Config.TextWidth)
+	}
+	return text, nil
+}
+
+// footnoteLinks numbers the links of the HTML body like "text [1]" and
+// removes their targets, returning the targets in the order of the numbers.
+// Links to the same target share the number.
+func footnoteLinks(body string) (string, []string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", nil, err
+	}
+
+	var links []string
+	numbers := make(map[string]int)
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if node.Type != html.ElementNode || node.DataAtom != atom.A {
+			return
+		}
+
+		for i, attr := range node.Attr {
+			if attr.Key != "href" {
+				continue
+			}
+			link := strings.TrimSpace(attr.Val)
+			node.Attr = append(node.Attr[:i], node.Attr[i+1:]...)
+
+			// Leave out anchors, mail addresses and links showing the target
+			if link == "" || strings.HasPrefix(link, "#") || strings.HasPrefix(link, "mailto:") {
+				return
+			}
+			if child := node.FirstChild; child != nil && child.NextSibling == nil && child.Type == html.TextNode && strings.TrimSpace(child.Data) == link {
+				return
+			}
+
+			number, ok := numbers[link]
+			if !ok {
+				links = append(links, link)
+				number = len(links)
+				numbers[link] = number
+			}
+			node.AppendChild(&html.Node{Type: html.TextNode, Data: fmt.Sprintf(" [%d]", number)})
+			return
+		}
+	}
+	walk(doc)
+
+	var buf strings.Builder
+	if err := html.Render(&buf, doc); err != nil {
+		return "", nil, err
+	}
+	return buf.String(), links, nil
+}
+
+// wrapText wraps the lines longer than the width at spaces, keeping their
+// indentation. Words longer than the width like links and the lines of
+// pretty tables are left as is.
+func wrapText(text string, width int) string {
+	lines := strings.Split(text, "\n")
+	wrapped := make([]string, 0, len(lines))
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		if utf8.RuneCountInString(line) <= width || strings.HasPrefix(trimmed, "|") || strings.HasPrefix(trimmed, "+") {
+			wrapped = append(wrapped, line)
+			continue
+		}
+
+		indent := line[:len(line)-len(trimmed)]
+		current := indent
+		for _, word := range strings.Fields(trimmed) {
+			if current != indent && utf8.RuneCountInString(current)+1+utf8.RuneCountInString(word) > width {
+				wrapped = append(wrapped, current)
+				current = indent
+			}
+			if current != indent {
+				current += " "
+			}
+			current += word
+		}
+		wrapped = append(wrapped, current)
+	}
+	return strings.Join(wrapped, "\n")
+}
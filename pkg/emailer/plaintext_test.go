@@ -0,0 +1,113 @@
+package emailer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		width int
+		want  string
+	}{
+		{
+			name:  "short",
+			text:  "Build succeeded",
+			width: 20,
+			want:  "Build succeeded",
+		},
+		{
+			name:  "wrapped at spaces",
+			text:  "The build of octocat/hello-world succeeded",
+			width: 20,
+			want:  "The build of\noctocat/hello-world\nsucceeded",
+		},
+		{
+			name:  "indentation kept",
+			text:  "  * the quick brown fox jumps",
+			width: 16,
+			want:  "  * the quick\n  brown fox\n  jumps",
+		},
+		{
+			name:  "long words kept",
+			text:  "see https://drone.example.com/octocat/hello-world/42 for details",
+			width: 20,
+			want:  "see\nhttps://drone.example.com/octocat/hello-world/42\nfor details",
+		},
+		{
+			name:  "tables kept",
+			text:  "+------+------------+\n| Step | Status     |",
+			width: 10,
+			want:  "+------+------------+\n| Step | Status     |",
+		},
+		{
+			name:  "runes counted",
+			text:  "größer kleiner",
+			width: 13,
+			want:  "größer\nkleiner",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := wrapText(test.text, test.width); got != test.want {
+				t.Errorf("wrapText() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFootnoteLinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		contains []string
+		links    []string
+	}{
+		{
+			name:     "numbered",
+			body:     `<a href="https://example.com/build">build</a> and <a href="https://example.com/commit">commit</a>`,
+			contains: []string{"build [1]</a>", "commit [2]</a>"},
+			links:    []string{"https://example.com/build", "https://example.com/commit"},
+		},
+		{
+			name:     "same target shares the number",
+			body:     `<a href="https://example.com/build">build</a> <a href="https://example.com/build">again</a>`,
+			contains: []string{"build [1]</a>", "again [1]</a>"},
+			links:    []string{"https://example.com/build"},
+		},
+		{
+			name:     "anchors and mail addresses left out",
+			body:     `<a href="#top">top</a> <a href="mailto:ci@example.com">mail</a>`,
+			contains: []string{"<a>top</a>", "<a>mail</a>"},
+		},
+		{
+			name:     "links showing the target left out",
+			body:     `<a href="https://example.com">https://example.com</a>`,
+			contains: []string{"<a>https://example.com</a>"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, links, err := footnoteLinks(test.body)
+			if err != nil {
+				t.Fatalf("footnoteLinks() error = %v", err)
+			}
+			for _, want := range test.contains {
+				if !strings.Contains(body, want) {
+					t.Errorf("footnoteLinks() body = %q, want it to contain %q", body, want)
+				}
+			}
+			if strings.Contains(body, "href") {
+				t.Errorf("footnoteLinks() body = %q, want no link targets", body)
+			}
+			if !slices.Equal(links, test.links) {
+				t.Errorf("footnoteLinks() links = %q, want %q", links, test.links)
+			}
+		})
+	}
+}
@@ -0,0 +1,998 @@
+package emailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aymerick/douceur/inliner"
+	log "github.com/sirupsen/logrus"
+	mail "github.com/wneessen/go-mail"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type (
+	Repo struct {
+		FullName string
+		Owner    string
+		Name     string
+		SCM      string
+		Link     string
+		Avatar   string
+		Branch   string
+		Private  bool
+		Trusted  bool
+	}
+
+	Remote struct {
+		URL string
+	}
+
+	Author struct {
+		Name   string
+		Email  string
+		Avatar string
+	}
+
+	Commit struct {
+		Sha     string
+		Before  string
+		Ref     string
+		Branch  string
+		Link    string
+		Message string
+		Author  Author
+	}
+
+	Build struct {
+		Number   int
+		Event    string
+		Status   string
+		Link     string
+		Created  float64
+		Started  float64
+		Finished float64
+	}
+
+	PrevBuild struct {
+		Status string
+		Number int
+	}
+
+	PrevCommit struct {
+		Sha string
+	}
+
+	Prev struct {
+		Build  PrevBuild
+		Commit PrevCommit
+	}
+
+	Job struct {
+		Number   int
+		Name     string
+		Status   string
+		ExitCode int
+		Started  float64
+		Finished float64
+	}
+
+	Yaml struct {
+		Signed   bool
+		Verified bool
+	}
+
+	Config struct {
+		FromAddress          string
+		FromName             string
+		Host                 string
+		Port                 int
+		Username             string
+		Password             string
+		SkipVerify           bool
+		NoStartTLS           bool
+		Recipients           []string
+		RecipientsFile       string
+		RecipientsOnly       bool
+		Subject              string
+		Body                 string
+		Attachment           string
+		Attachments          []string
+		ClientHostname       string
+		APIServer            string
+		APIToken             string
+		History              int
+		AttachLogs           bool
+		AttachLogsGzip       bool
+		LogFile              string
+		JUnitReports         []string
+		CoverageReport       string
+		CoverageBaseline     string
+		ArtifactLinks        []string
+		ArtifactLinksFile    string
+		EmbedImages          []string
+		Badge                bool
+		BadgeURL             string
+		DiffStat             bool
+		ExtractErrors        bool
+		ErrorPatterns        []string
+		ErrorLines           int
+		Calendar             bool
+		CalendarSummary      string
+		QRCode               bool
+		QRCodeSize           int
+		ClassifyFailures     bool
+		FailureRules         []string
+		FailureHints         []string
+		AttachHTML           bool
+		BrandName            string
+		BrandLogoURL         string
+		BrandColor           string
+		Footer               string
+		AttachDir            string
+		AttachDirMaxSize     string
+		MaxAttachmentSize    string
+		MaxMessageSize       string
+		OversizeAction       string
+		CompressAttachments  string
+		DownloadTimeout      time.Duration
+		DownloadMaxSize      string
+		DownloadHeader       string
+		AttachmentsRequired  bool
+		AttachmentTypes      []string
+		AttachStdin          string
+		AttachmentChecksums  bool
+		AttachmentExtensions []string
+		BodyEncoding         string
+		AttachmentEncoding   string
+		CustomHeaders        map[string]string
+		Priority             []string
+		Thread               bool
+		ThreadKey            string
+		ListID               string
+		ListUnsubscribe      []string
+		AutoSubmitted        bool
+		DroneHeaders         bool
+		ReadReceipt          []string
+		Sender               string
+		EnvelopeFrom         string
+		MessageIDDomain      string
+		VERP                 string
+		SubjectTag           bool
+		ReplyTo              string
+		SMIMECertificate     string
+		SMIMEKey             string
+		SMIMEPKCS12          string
+		SMIMEPassword        string
+		PGPKeyring           string
+		PGPSigningKey        string
+		PGPPassphrase        string
+		SanitizeHTML         bool
+		LogRecipients        string
+		AuditLog             string
+		TLSRequired          bool
+		Preflight            string
+		DryRun               bool
+		OutputDir            string
+		DebugSMTP            bool
+		MetricsURL           string
+		FailOnPartial        bool
+		ReportFile           string
+		CardPath             string
+		OTLPEndpoint         string
+		OTLPHeaders          []string
+		CheckOnly            bool
+		CallbackURL          string
+		ArchiveURL           string
+		Timeout              time.Duration
+		Concurrency          int
+		SpoolDir             string
+		Aggregate            bool
+		AggregateDir         string
+		AggregateJobs        int
+		AggregateTimeout     time.Duration
+		Digest               string
+		DigestDir            string
+		IMAPHost             string
+		IMAPPort             int
+		IMAPUsername         string
+		IMAPPassword         string
+		IMAPFolder           string
+		MailboxPath          string
+		MailboxFormat        string
+		Retries              int
+		RetryBackoff         time.Duration
+		GreylistWait         time.Duration
+		Keepalive            time.Duration
+		MessagesPerConn      int
+		Delivery             string
+		Format               string
+		TextBody             string
+		TextLinks            string
+		TextTables           string
+		TextWidth            int
+		BatchSize            int
+		VerifyRecipients     bool
+		Charset              string
+		Force7Bit            bool
+		Preview              string
+	}
+
+	Plugin struct {
+		Repo        Repo
+		Remote      Remote
+		Commit      Commit
+		Build       Build
+		Prev        Prev
+		Job         Job
+		Yaml        Yaml
+		Tag         string
+		PullRequest int
+		DeployTo    string
+		Config      Config
+
+		// Resolver, Renderer and Sender replace the default behavior
+		// based on the Config if set
+		Resolver RecipientResolver
+		Renderer Renderer
+		Sender   Sender
+	}
+)
+
+// Exec will send emails over SMTP
+func (p Plugin) Exec() error {
+	return p.ExecContext(context.Background())
+}
+
+// ExecContext will send emails over SMTP, aborting once the context is done
+// or the configured timeout elapsed
+func (p Plugin) ExecContext(ctx context.Context) error {
+	if p.Config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Config.Timeout)
+		defer cancel()
+	}
+
+	// Report all problems of the settings at once instead of failing on the
+	// first one while sending
+	if err := p.ValidateConfig(); err != nil {
+		var configErr *ConfigError
+		if errors.As(err, &configErr) {
+			for _, problem := range configErr.Problems {
+				log.Errorf("Invalid setting %v", problem)
+			}
+		}
+		return err
+	}
+
+	// Only verify the connection to the SMTP server
+	if p.Config.CheckOnly {
+		return p.check(ctx)
+	}
+
+	shutdown, err := p.startTracing()
+	if err != nil {
+		log.Warnf("Could not start tracing: %v", err)
+	} else {
+		defer shutdown()
+	}
+
+	timing := newTimings()
+	defer timing.log()
+
+	traceCtx, span := tracer.Start(ctx, "notify")
+	err = p.exec(traceCtx, timing)
+	endSpan(span, err)
+	return err
+}
+
+func (p Plugin) exec(traceCtx context.Context, timing *timings) (err error) {
+	// Send one email with the outcomes of all jobs of the build
+	var jobs []AggregateJob
+	if p.Config.Aggregate {
+		aggregateCtx, phase := timing.start(traceCtx, "aggregate")
+		var ok bool
+		var err error
+		jobs, ok, err = p.aggregate(aggregateCtx)
+		phase.end(err)
+		if err != nil {
+			log.Errorf("Could not aggregate the jobs: %v", err)
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		p.Build.Status = aggregateStatus(jobs)
+	}
+
+	// Collect the build for the next digest instead of sending, or send the
+	// builds collected since the last digest
+	var digest *Digest
+	switch p.Config.Digest {
+	case DigestCollect:
+		if err := p.collectDigest(); err != nil {
+			log.Errorf("Could not collect build for the digest: %v", err)
+			return err
+		}
+		return nil
+	case DigestSend:
+		var collected []string
+		digest, collected, err = p.readDigest()
+		if err != nil {
+			log.Errorf("Could not read the collected builds: %v", err)
+			return err
+		}
+		if digest.Total == 0 {
+			log.Info("No builds collected since the last digest")
+			return nil
+		}
+		log.Infof("Sending digest of %d builds", digest.Total)
+		defer func() {
+			if err == nil {
+				for _, file := range collected {
+					os.Remove(file)
+				}
+			}
+		}()
+
+		p.Build.Status = "success"
+		if digest.Failed > 0 {
+			p.Build.Status = "failure"
+		}
+		if p.Config.Subject == DefaultSubject {
+			p.Config.Subject = DefaultDigestSubject
+		}
+	}
+
+	// Build recipient list
+	_, phase := timing.start(traceCtx, "resolve recipients")
+	resolved, err := p.resolver().Recipients()
+	phase.end(err)
+	if err != nil {
+		log.Errorf("Could not resolve recipients: %v", err)
+		return err
+	}
+	recipientsMap := make(map[string]struct{}, len(resolved))
+	for _, recipient := range resolved {
+		recipientsMap[recipient] = struct{}{}
+	}
+
+	switch p.Config.LogRecipients {
+	case LogRecipientsNone:
+		log.Infof("Recipients: %d", len(recipientsMap))
+	default:
+		recipients := make([]string, 0, len(recipientsMap))
+		for recipient := range recipientsMap {
+			recipients = append(recipients, p.logRecipient(recipient))
+		}
+		sort.Strings(recipients)
+		log.Infof("Recipients: %v", recipients)
+	}
+	phase.SetAttributes(attribute.Int("recipients", len(recipientsMap)))
+
+	// Logs of the failed steps are fetched at most once, on first use
+	failedLogs := sync.OnceValue(func() []stepLog { return p.failedLogs(traceCtx) })
+
+	// Prepare template context
+	type Context struct {
+		Repo        Repo
+		Remote      Remote
+		Commit      Commit
+		Build       Build
+		Prev        Prev
+		Job         Job
+		Jobs        []AggregateJob
+		Digest      *Digest
+		Yaml        Yaml
+		Tag         string
+		PullRequest int
+		DeployTo    string
+		History     []HistoryBuild
+		Logs        *Logs
+		JUnit       *TestReport `handlebars:"junit"`
+		Coverage    *Coverage
+		Artifacts   []ArtifactLink
+		Badge       string
+		Diffstat    *DiffStat
+		Errors      []string
+		QRCode      string `handlebars:"qrcode"`
+		Failure     *Failure
+		Brand       *Brand
+		Recipient   map[string]string
+	}
+	ctx := Context{
+		Repo:        p.Repo,
+		Remote:      p.Remote,
+		Commit:      p.Commit,
+		Build:       p.Build,
+		Prev:        p.Prev,
+		Job:         p.Job,
+		Jobs:        jobs,
+		Digest:      digest,
+		Yaml:        p.Yaml,
+		Tag:         p.Tag,
+		PullRequest: p.PullRequest,
+		DeployTo:    p.DeployTo,
+		History:     p.history(traceCtx),
+		Logs:        p.newLogs(failedLogs),
+		JUnit:       p.testReport(),
+		Coverage:    p.coverage(),
+		Diffstat:    p.diffStat(),
+		Brand:       p.brand(),
+	}
+	ctx.Artifacts = p.artifactLinks(ctx)
+	ctx.Errors = p.errorExcerpt(ctx.Logs)
+	ctx.Failure = p.classifyFailure(ctx.Logs)
+
+	// Render the sender identity, allowing per repository senders
+	if p.Config.FromAddress, p.Config.FromName, p.Config.ReplyTo, err = p.senderIdentity(ctx); err != nil {
+		log.Errorf("Could not render sender: %v", err)
+		return err
+	}
+
+	// Internationalized addresses are sent as is if the server supports
+	// SMTPUTF8, otherwise the domains are IDNA encoded
+	if p.Sender == nil && !p.Config.DryRun && p.Config.Preview == "" &&
+		internationalized(append(slices.Collect(maps.Keys(recipientsMap)), p.Config.FromAddress, p.Config.EnvelopeFrom, p.Config.ReplyTo, p.Config.VERP)...) {
+		supported, err := p.supportsExtension(traceCtx, "SMTPUTF8")
+		switch {
+		case err != nil:
+			log.Warnf("Could not check SMTPUTF8 support: %v", err)
+		case supported:
+			log.Debug("Sending internationalized addresses with SMTPUTF8")
+		default:
+			if err := asciiAddresses(recipientsMap, &p.Config.FromAddress, &p.Config.EnvelopeFrom, &p.Config.ReplyTo, &p.Config.VERP); err != nil {
+				log.Errorf("SMTP server %s does not support SMTPUTF8: %v", p.Config.Host, err)
+				return err
+			}
+			log.Info("SMTP server does not support SMTPUTF8, sending IDNA encoded domains")
+		}
+	}
+
+	// Unencoded 8-bit bodies and attachments need the 8BITMIME extension,
+	// fall back to 7-bit safe encodings otherwise
+	if p.Sender == nil && !p.Config.DryRun && p.Config.Preview == "" && !p.Config.Force7Bit &&
+		(strings.EqualFold(p.Config.BodyEncoding, "8bit") || strings.EqualFold(p.Config.AttachmentEncoding, "8bit")) {
+		supported, err := p.supportsExtension(traceCtx, "8BITMIME")
+		switch {
+		case err != nil:
+			log.Warnf("Could not check 8BITMIME support: %v", err)
+		case !supported:
+			log.Warn("SMTP server does not support 8BITMIME, sending 7-bit safe encodings")
+			p.Config.Force7Bit = true
+		}
+	}
+
+	// Remove the recipients the server rejects before building the messages,
+	// so a dead address does not fail the delivery to the others
+	if p.Config.VerifyRecipients && p.Sender == nil && !p.Config.DryRun && p.Config.Preview == "" {
+		verifyCtx, phase := timing.start(traceCtx, "verify recipients")
+		err := p.verifyRecipients(verifyCtx, recipientsMap)
+		phase.end(err)
+		if err != nil {
+			log.Errorf("Could not verify recipients: %v", err)
+			return err
+		}
+	}
+
+	// Attachments generated at runtime or read from disk
+	var attachments []attachment
+
+	// Create the status badge embedded by the templates
+	if p.Config.Badge && p.Config.Format != FormatText {
+		badge, err := p.badge(ctx)
+		if err != nil {
+			log.Warnf("Could not create status badge: %v", err)
+		} else {
+			attachments = append(attachments, *badge)
+			ctx.Badge = "cid:" + badge.Name
+		}
+	}
+
+	// Create the QR code of the build link embedded by the templates
+	if p.Config.QRCode && p.Config.Format != FormatText {
+		qr, err := p.qrCode()
+		if err != nil {
+			log.Warnf("Could not create QR code: %v", err)
+		} else {
+			attachments = append(attachments, *qr)
+			ctx.QRCode = "cid:" + qr.Name
+		}
+	}
+
+	// Render the body in HTML and plain text, the subject and the headers
+	render := func(ctx Context) (personalized, error) {
+		// Escape HTML injected through commit data in the HTML body only, the
+		// subject, plain text and headers get the values as is
+		htmlCtx := ctx
+		if p.Config.SanitizeHTML {
+			htmlCtx.Commit = sanitizeCommit(ctx.Commit)
+			htmlCtx.Tag = sanitizeTag(ctx.Tag)
+		}
+
+		// Render the footer enforced independently of the body template
+		renderFooter := func(ctx Context) (string, error) {
+			if p.Config.Footer == "" {
+				return "", nil
+			}
+			footer, err := p.renderer(traceCtx).Render(p.Config.Footer, ctx)
+			if err != nil {
+				log.Errorf("Could not render footer template: %v", err)
+			}
+			return footer, err
+		}
+
+		// Render the plain text template, appending the footer as is
+		renderText := func() (string, error) {
+			_, phase := timing.start(traceCtx, "render")
+			renderedText, err := p.renderer(traceCtx).Render(p.Config.TextBody, ctx)
+			phase.end(err)
+			if err != nil {
+				log.Errorf("Could not render text body template: %v", err)
+				return "", err
+			}
+			footer, err := renderFooter(ctx)
+			if err != nil {
+				return "", err
+			}
+			text := strings.TrimSpace(renderedText)
+			if footer != "" {
+				text += "\n\n" + strings.TrimSpace(footer)
+			}
+			return text, nil
+		}
+
+		var html, plainBody string
+		if p.Config.Format == FormatText {
+			// Render the plain text template only, skipping the HTML body
+			var err error
+			if plainBody, err = renderText(); err != nil {
+				return personalized{}, err
+			}
+		} else {
+			_, phase := timing.start(traceCtx, "render")
+			renderedBody, err := p.renderer(traceCtx).Render(p.Config.Body, htmlCtx)
+			phase.end(err)
+			if err != nil {
+				log.Errorf("Could not render body template: %v", err)
+				return personalized{}, err
+			}
+			footer, err := renderFooter(htmlCtx)
+			if err != nil {
+				return personalized{}, err
+			}
+			if footer != "" {
+				renderedBody = appendFooter(renderedBody, footer)
+			}
+
+			_, phase = timing.start(traceCtx, "inline")
+			html, err = inliner.Inline(renderedBody)
+			phase.end(err)
+			if err != nil {
+				log.Errorf("Could not inline rendered body: %v", err)
+				return personalized{}, err
+			}
+
+			// Send the HTML body only unless a text template is set instead
+			// of converting the HTML
+			switch {
+			case p.Config.Format != FormatHTML:
+				plainBody, err = p.htmlToText(html)
+				if err != nil {
+					log.Errorf("Could not convert html to text: %v", err)
+					return personalized{}, err
+				}
+			case p.Config.TextBody != "" && p.Config.TextBody != DefaultTextTemplate:
+				if plainBody, err = renderText(); err != nil {
+					return personalized{}, err
+				}
+			}
+		}
+
+		subject, err := p.renderer(traceCtx).Render(p.Config.Subject, ctx)
+		if err != nil {
+			log.Errorf("Could not render subject template: %v", err)
+			return personalized{}, err
+		}
+		if p.Config.SubjectTag {
+			subject = p.tagSubject(subject)
+		}
+
+		headers, err := p.headers(ctx)
+		if err != nil {
+			log.Errorf("Could not render headers: %v", err)
+			return personalized{}, err
+		}
+
+		return personalized{
+			Subject: subject,
+			HTML:    html,
+			Text:    plainBody,
+			Headers: headers,
+		}, nil
+	}
+	rendered, err := render(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Render the content again for every recipient with variables in the
+	// recipients file
+	personal := make(map[string]personalized)
+	for recipient, variables := range p.recipientVariables() {
+		if _, ok := recipientsMap[recipient]; !ok {
+			continue
+		}
+		recipientCtx := ctx
+		recipientCtx.Recipient = variables
+		if personal[recipient], err = render(recipientCtx); err != nil {
+			return err
+		}
+	}
+
+	importance, err := p.importance()
+	if err != nil {
+		log.Errorf("Could not determine priority: %v", err)
+		return err
+	}
+
+	smime, err := p.smimeCertificate()
+	if err != nil {
+		log.Errorf("Could not load S/MIME certificate: %v", err)
+		return err
+	}
+
+	pgp, err := p.pgpKeys()
+	if err != nil {
+		log.Errorf("Could not load PGP keys: %v", err)
+		return err
+	}
+
+	thread, err := p.thread(ctx)
+	if err != nil {
+		log.Errorf("Could not render thread key: %v", err)
+		return err
+	}
+
+	readReceipt, err := p.readReceipt(ctx)
+	if err != nil {
+		log.Errorf("Could not render read receipt address: %v", err)
+		return err
+	}
+
+	// Attach the rendered body to be opened in a browser
+	if p.Config.AttachHTML && rendered.HTML != "" {
+		attachments = append(attachments, attachment{
+			Name: "build-report.html",
+			Data: []byte(rendered.HTML),
+		})
+	}
+
+	// Expand the attachment patterns once for all recipients
+	files, err := p.fileAttachments(traceCtx, ctx)
+	if err != nil {
+		log.Errorf("Could not resolve attachments: %v", err)
+		return err
+	}
+	attachments = append(attachments, files...)
+
+	// Attach the content piped to the plugin
+	if p.Config.AttachStdin != "" {
+		name, err := renderInline(p.Config.AttachStdin, ctx)
+		if err != nil {
+			log.Errorf("Could not render stdin attachment name: %v", err)
+			return err
+		}
+		a, err := stdinAttachment(name)
+		if err != nil {
+			log.Warnf("Could not attach stdin: %v", err)
+		} else {
+			attachments = append(attachments, *a)
+		}
+	}
+
+	// Embed images referenced by Content-ID
+	for _, image := range p.Config.EmbedImages {
+		image, err := renderInline(image, ctx)
+		if err != nil {
+			log.Errorf("Could not render embedded image path: %v", err)
+			return err
+		}
+		a, err := fileAttachment(image, true)
+		if err != nil {
+			log.Warnf("Could not embed image %s: %v", image, err)
+			continue
+		}
+		attachments = append(attachments, a)
+	}
+
+	// Zip the attached directory
+	if p.Config.AttachDir != "" {
+		archive, err := p.dirAttachment(ctx)
+		if err != nil {
+			log.Warnf("Could not attach directory %s: %v", p.Config.AttachDir, err)
+		} else {
+			attachments = append(attachments, *archive)
+		}
+	}
+
+	// Create the calendar entry for deployments
+	calendar, err := p.calendar(ctx)
+	if err != nil {
+		log.Warnf("Could not create calendar entry: %v", err)
+	} else if calendar != nil {
+		attachments = append(attachments, *calendar)
+	}
+
+	// Fetch the logs of the failed steps
+	if p.Config.AttachLogs {
+		attachments = append(attachments, p.logAttachments(failedLogs())...)
+	}
+
+	// Compress the attachments before enforcing the size limits, the content
+	// type overrides decide which attachments are already compressed
+	attachments, err = p.compressAttachments(attachments)
+	if err != nil {
+		log.Errorf("Could not compress attachments: %v", err)
+		return err
+	}
+
+	// Override the content types guessed from the file extension
+	attachments, err = p.applyContentTypes(attachments)
+	if err != nil {
+		log.Errorf("Could not apply attachment types: %v", err)
+		return err
+	}
+
+	// Enforce the attachment size limits, measuring the message built for
+	// an arbitrary recipient as all messages share the same content
+	var sample string
+	for recipient := range recipientsMap {
+		sample = recipient
+		break
+	}
+
+	content := message{
+		Subject:      rendered.Subject,
+		HTML:         rendered.HTML,
+		Text:         rendered.Text,
+		Headers:      rendered.Headers,
+		Importance:   importance,
+		Thread:       thread,
+		ReadReceipt:  readReceipt,
+		SMIME:        smime,
+		PGP:          pgp,
+		Personalized: personal,
+	}
+	// The notes on skipped attachments and checksums are part of the message,
+	// so they are added before the message is measured
+	withNotes := func(kept, skipped []attachment) (message, error) {
+		m := content.withSkippedNote(skipped)
+		m.Attachments = kept
+
+		// List the checksums of the attachments to verify downloaded artifacts
+		if p.Config.AttachmentChecksums && len(kept) > 0 {
+			htmlNote, textNote, err := checksumNote(kept)
+			if err != nil {
+				return m, err
+			}
+			m = m.withNote(htmlNote, textNote)
+		}
+		return m, nil
+	}
+	attachments, skipped, err := p.limitAttachments(attachments, func(kept, skipped []attachment) (int64, error) {
+		m, _ := withNotes(kept, skipped)
+		return p.messageSize(sample, m)
+	})
+	if err != nil {
+		log.Errorf("Could not add attachments: %v", err)
+		return err
+	}
+	for _, a := range skipped {
+		log.Warnf("Skipping attachment %s of %d bytes exceeding the size limits", a.Name, a.size())
+	}
+	content, err = withNotes(attachments, skipped)
+	if err != nil {
+		log.Warnf("Could not calculate attachment checksums: %v", err)
+	}
+
+	// Write the rendered message for review instead of sending it
+	if p.Config.Preview != "" {
+		return p.preview(os.Stdout, recipientsMap, content)
+	}
+
+	// Build the messages without sending them
+	if p.Config.DryRun {
+		return p.dryRun(recipientsMap, content)
+	}
+
+	// Check the DNS records of the from domain against the relay
+	if err := p.preflight(); err != nil {
+		log.Errorf("Preflight failed: %v", err)
+		return err
+	}
+
+	// Send the messages previous runs failed to deliver first
+	if p.Config.SpoolDir != "" && p.Sender == nil {
+		flushCtx, phase := timing.start(traceCtx, "flush spool")
+		p.flushSpool(flushCtx)
+		phase.end(nil)
+	}
+
+	client, err := p.sender()
+	if err != nil {
+		log.Errorf("Error creating mail client: %v", err)
+		return err
+	}
+
+	// Record every sent message for traceability
+	audit, err := p.openAuditLog()
+	if err != nil {
+		log.Errorf("Could not open audit log: %v", err)
+		return err
+	}
+	defer audit.Close()
+
+	// Archive every sent message for retention
+	archive, err := p.openArchive(traceCtx)
+	if err != nil {
+		log.Errorf("Could not open archive: %v", err)
+		return err
+	}
+	defer archive.Close()
+
+	// Write every sent message to a local mbox file or Maildir
+	mailbox, err := p.openMailbox()
+	if err != nil {
+		log.Errorf("Could not open mailbox: %v", err)
+		return err
+	}
+
+	// Keep a copy of every sent message in a shared mailbox, the messages
+	// are sent regardless
+	sent, err := p.openSentFolder(traceCtx)
+	if err != nil {
+		log.Warnf("Could not open IMAP folder: %v", err)
+	}
+	defer sent.Close()
+
+	// Report the delivery once done, unsent messages count as failed
+	report := p.newDeliveryReport(len(recipientsMap))
+	metrics := deliveryMetrics{Attempted: len(recipientsMap)}
+	defer func() {
+		metrics.Bytes = report.Bytes
+		if err := p.pushMetrics(metrics); err != nil {
+			log.Warnf("Could not push metrics: %v", err)
+		}
+	}()
+	defer func() {
+		report.finish()
+		report.log(time.Since(timing.started))
+		if err := p.writeReport(report); err != nil {
+			log.Warnf("Could not write delivery report: %v", err)
+		}
+		if err := p.writeCard(report); err != nil {
+			log.Warnf("Could not write card: %v", err)
+		}
+		if err := p.postCallback(report); err != nil {
+			log.Warnf("Could not post callback: %v", err)
+		}
+	}()
+
+	d := &delivery{
+		report:  report,
+		metrics: &metrics,
+		audit:   audit,
+		archive: archive,
+		mailbox: mailbox,
+		sent:    sent,
+	}
+
+	// Send the recipients sharing the content a single message per batch,
+	// the others are sent individually
+	pending := recipientsMap
+	if p.Config.Delivery == DeliveryBatch && p.Sender == nil {
+		pending = p.deliverBatches(traceCtx, timing, recipientsMap, content, d)
+	}
+
+	var canceled error
+	if len(pending) > 0 {
+		// Dial the connections once and reuse them for all recipients
+		dialCtx, phase := timing.start(traceCtx, "dial")
+		clients, err := p.dialClients(dialCtx, client, len(pending))
+		phase.end(err)
+		if err != nil {
+			log.Errorf("Error while dialing SMTP server: %v", err)
+			report.Error = err.Error()
+			if p.Config.TLSRequired {
+				for _, line := range strings.Split(strings.TrimSpace(p.tlsDiagnostics()), "\n") {
+					log.Error(line)
+				}
+			}
+			if p.Config.SpoolDir != "" {
+				p.spoolAll(pending, content)
+			}
+			return err
+		}
+		for _, client := range clients {
+			defer client.Close()
+		}
+
+		canceled = p.deliverEach(traceCtx, timing, clients, pending, content, d)
+	}
+
+	if d.err != nil {
+		return d.err
+	}
+	if canceled != nil {
+		log.Errorf("Aborting delivery: %v", context.Cause(traceCtx))
+		report.Error = canceled.Error()
+		return fmt.Errorf("aborted delivery after %d of %d recipients: %w", report.Sent+report.Failed, len(recipientsMap), canceled)
+	}
+	if d.failed == len(recipientsMap) || (d.failed > 0 && p.Config.FailOnPartial) {
+		return fmt.Errorf("could not send email to %d of %d recipients", d.failed, len(recipientsMap))
+	}
+	if d.unarchived > 0 {
+		return fmt.Errorf("could not archive %d sent emails", d.unarchived)
+	}
+	return nil
+}
+
+// newClient creates the mail client for the configured SMTP server
+func (p Plugin) newClient() (*mail.Client, error) {
+	// Create mail client with options
+	options := []mail.Option{
+		mail.WithPort(p.Config.Port),
+	}
+
+	// Set HELO hostname if provided
+	if p.Config.ClientHostname != "" {
+		options = append(options, mail.WithHELO(p.Config.ClientHostname))
+	}
+
+	// Add authentication if provided
+	if p.Config.Username != "" && p.Config.Password != "" {
+		options = append(options,
+			mail.WithSMTPAuth(mail.SMTPAuthPlain),
+			mail.WithUsername(p.Config.Username),
+			mail.WithPassword(p.Config.Password),
+		)
+	}
+
+	// Handle TLS configuration
+	if p.Config.SkipVerify {
+		options = append(options, mail.WithTLSConfig(&tls.Config{
+			InsecureSkipVerify: true,
+		}))
+	}
+
+	// Handle STARTTLS policy
+	// Note: Use WithTLSPolicy (not WithTLSPortPolicy) to avoid overriding
+	// the user-configured port. WithTLSPortPolicy treats port 25 as "default/unset"
+	// and silently changes it to 587 for TLSOpportunistic/TLSMandatory.
+	switch {
+	case p.Config.NoStartTLS && p.Config.TLSRequired:
+		return nil, fmt.Errorf("no.starttls and tls.required are mutually exclusive")
+	case p.Config.NoStartTLS:
+		options = append(options, mail.WithTLSPolicy(mail.NoTLS))
+	case p.Config.TLSRequired:
+		options = append(options, mail.WithTLSPolicy(mail.TLSMandatory))
+	default:
+		options = append(options, mail.WithTLSPolicy(mail.TLSOpportunistic))
+	}
+
+	// Log the SMTP conversation, the authentication data is never logged
+	if p.Config.DebugSMTP {
+		options = append(options, mail.WithDebugLog(), mail.WithLogger(smtpLogger{}))
+	}
+
+	return mail.NewClient(p.Config.Host, options...)
+}
@@ -0,0 +1,258 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Preflight modes checking the DNS records of the from domain
+const (
+	PreflightOff  = "off"
+	PreflightWarn = "warn"
+	PreflightFail = "fail"
+)
+
+// spfMaxLookups limits the nested SPF records evaluated as RFC 7208 does
+const spfMaxLookups = 10
+
+// preflight checks the SPF and DMARC records of the from domain against the
+// SMTP relay and reports problems likely causing the messages to be rejected
+// or filtered as spam. Problems fail the step in fail mode.
+func (p Plugin) preflight() error {
+	switch p.Config.Preflight {
+	case "", PreflightOff:
+		return nil
+	case PreflightWarn, PreflightFail:
+	default:
+		return fmt.Errorf("unknown preflight mode %q", p.Config.Preflight)
+	}
+
+	_, domain, ok := strings.Cut(p.Config.FromAddress, "@")
+	if !ok || domain == "" {
+		return fmt.Errorf("could not determine the domain of the from address %q", p.Config.FromAddress)
+	}
+	domain = strings.ToLower(strings.TrimSuffix(domain, ">"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var problems []string
+
+	relayIPs, err := net.DefaultResolver.LookupIP(ctx, "ip", p.Config.Host)
+	if err != nil {
+		log.Warnf("Preflight: could not resolve the SMTP host %s: %v", p.Config.Host, err)
+	}
+
+	spf := &spfChecker{ctx: ctx}
+	result, err := spf.check(domain, relayIPs)
+	switch {
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("could not evaluate the SPF record of %s: %v", domain, err))
+	case result == "none":
+		problems = append(problems, fmt.Sprintf("%s has no SPF record", domain))
+	case result == "fail" || result == "softfail":
+		problems = append(problems, fmt.Sprintf("the SPF record of %s does not authorize the SMTP host %s (%s), unless the relay sends from other addresses", domain, p.Config.Host, result))
+	}
+
+	policy, err := dmarcPolicy(ctx, domain)
+	switch {
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("could not look up the DMARC record of %s: %v", domain, err))
+	case policy == "":
+		problems = append(problems, fmt.Sprintf("%s has no DMARC record", domain))
+	case (policy == "reject" || policy == "quarantine") && result != "pass":
+		problems = append(problems, fmt.Sprintf("the DMARC policy of %s is %s and SPF does not pass, messages are only delivered if the relay signs them with DKIM for %s", domain, policy, domain))
+	}
+
+	for _, problem := range problems {
+		log.Warnf("Preflight: %s", problem)
+	}
+	if len(problems) > 0 && p.Config.Preflight == PreflightFail {
+		return fmt.Errorf("preflight found %d problems with the from domain %s", len(problems), domain)
+	}
+	return nil
+}
+
+// dmarcPolicy returns the policy of the DMARC record of the domain or an
+// empty string if there is none
+func dmarcPolicy(ctx context.Context, domain string) (string, error) {
+	records, err := lookupTXT(ctx, "_dmarc."+domain)
+	if err != nil {
+		return "", err
+	}
+	for _, record := range records {
+		if !strings.HasPrefix(strings.ToLower(record), "v=dmarc1") {
+			continue
+		}
+		for _, tag := range strings.Split(record, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(tag), "=")
+			if strings.EqualFold(key, "p") {
+				return strings.ToLower(strings.TrimSpace(value)), nil
+			}
+		}
+		return "none", nil
+	}
+	return "", nil
+}
+
+// lookupTXT returns the TXT records of the name, treating a missing name as
+// no records
+func lookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, err := net.DefaultResolver.LookupTXT(ctx, name)
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	return records, err
+}
+
+// spfChecker evaluates SPF records for a set of addresses. It supports the
+// all, ip4, ip6, a, mx and include mechanisms and the redirect modifier.
+type spfChecker struct {
+	ctx     context.Context
+	lookups int
+}
+
+// check returns the SPF result of the domain for the addresses, which is
+// pass if any address is authorized, or none if there is no SPF record
+func (c *spfChecker) check(domain string, ips []net.IP) (string, error) {
+	c.lookups++
+	if c.lookups > spfMaxLookups {
+		return "", fmt.Errorf("too many nested spf lookups")
+	}
+
+	records, err := lookupTXT(c.ctx, domain)
+	if err != nil {
+		return "", err
+	}
+	var record string
+	for _, r := range records {
+		if strings.HasPrefix(strings.ToLower(r), "v=spf1") {
+			if record != "" {
+				return "", fmt.Errorf("multiple spf records")
+			}
+			record = r
+		}
+	}
+	if record == "" {
+		return "none", nil
+	}
+
+	var redirect string
+	for _, term := range strings.Fields(record)[1:] {
+		term = strings.ToLower(term)
+		if value, ok := strings.CutPrefix(term, "redirect="); ok {
+			redirect = value
+			continue
+		}
+
+		result := "pass"
+		switch term[0] {
+		case '+':
+			term = term[1:]
+		case '-':
+			result, term = "fail", term[1:]
+		case '~':
+			result, term = "softfail", term[1:]
+		case '?':
+			result, term = "neutral", term[1:]
+		}
+
+		matched, err := c.match(domain, term, ips)
+		if err != nil {
+			return "", err
+		}
+		if matched {
+			return result, nil
+		}
+	}
+
+	if redirect != "" {
+		return c.check(redirect, ips)
+	}
+	return "neutral", nil
+}
+
+// match reports whether the mechanism matches any of the addresses
+func (c *spfChecker) match(domain, mechanism string, ips []net.IP) (bool, error) {
+	name, value, _ := strings.Cut(mechanism, ":")
+	value, prefix, _ := strings.Cut(value, "/")
+	if value == "" {
+		value = domain
+	}
+
+	switch name {
+	case "all":
+		return true, nil
+
+	case "ip4", "ip6":
+		cidr := value
+		if prefix != "" {
+			cidr += "/" + prefix
+		}
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return false, nil
+		}
+		return containsAny(network, ips), nil
+
+	case "a", "mx":
+		c.lookups++
+		hosts := []string{value}
+		if name == "mx" {
+			mxs, err := net.DefaultResolver.LookupMX(c.ctx, value)
+			if err != nil {
+				return false, nil
+			}
+			hosts = hosts[:0]
+			for _, mx := range mxs {
+				hosts = append(hosts, mx.Host)
+			}
+		}
+		for _, host := range hosts {
+			addrs, err := net.DefaultResolver.LookupIP(c.ctx, "ip", host)
+			if err != nil {
+				continue
+			}
+			for _, addr := range addrs {
+				for _, ip := range ips {
+					if addr.Equal(ip) {
+						return true, nil
+					}
+				}
+			}
+		}
+		return false, nil
+
+	case "include":
+		result, err := c.check(value, ips)
+		if err != nil {
+			return false, err
+		}
+		return result == "pass", nil
+	}
+
+	// exists and ptr can't be evaluated without the actual sending address
+	return false, nil
+}
+
+// containsAny reports whether the network contains any of the addresses
+func containsAny(network *net.IPNet, ips []net.IP) bool {
+	for _, ip := range ips {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package emailer
+
+import (
+	"errors"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// DefaultQRCodeSize is the default width and height of the QR code in pixels
+const DefaultQRCodeSize = 128
+
+// qrCode returns a QR code image of the build link embedded into the message
+func (p Plugin) qrCode() (*attachment, error) {
+	if p.Build.Link == "" {
+		return nil, errors.New("build link is empty")
+	}
+
+	size := p.Config.QRCodeSize
+	if size <= 0 {
+		size = DefaultQRCodeSize
+	}
+
+	data, err := qrcode.Encode(p.Build.Link, qrcode.Medium, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachment{Name: "qrcode.png", Data: data, Inline: true}, nil
+}
@@ -0,0 +1,59 @@
+package emailer
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	mail "github.com/wneessen/go-mail"
+)
+
+// recyclingSender quits the connection and dials a new one once the limit of
+// messages is sent over it, for servers capping the messages per connection
+type recyclingSender struct {
+	Sender
+
+	ctx   context.Context
+	limit int
+	sent  int
+}
+
+// Send sends the messages, reconnecting first if the limit was reached
+func (s *recyclingSender) Send(messages ...*mail.Msg) error {
+	if s.sent >= s.limit {
+		log.Debugf("Reconnecting after sending %d messages", s.sent)
+		s.Sender.Close()
+		if err := s.DialWithContext(s.ctx); err != nil {
+			return err
+		}
+	}
+	s.sent += len(messages)
+	return s.Sender.Send(messages...)
+}
+
+// DialWithContext reconnects, starting to count the messages anew
+func (s *recyclingSender) DialWithContext(ctx context.Context) error {
+	s.sent = 0
+	return s.Sender.DialWithContext(ctx)
+}
+
+// Reset resets the connection for the keepalive, if the sender supports it
+func (s *recyclingSender) Reset() error {
+	if resetter, ok := s.Sender.(interface{ Reset() error }); ok {
+		return resetter.Reset()
+	}
+	return nil
+}
+
+// recycle wraps the clients to reconnect after the configured number of
+// messages per connection
+func (p Plugin) recycle(ctx context.Context, clients []Sender) []Sender {
+	if p.Config.MessagesPerConn <= 0 {
+		return clients
+	}
+
+	wrapped := make([]Sender, 0, len(clients))
+	for _, client := range clients {
+		wrapped = append(wrapped, &recyclingSender{Sender: client, ctx: ctx, limit: p.Config.MessagesPerConn})
+	}
+	return wrapped
+}
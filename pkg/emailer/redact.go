@@ -0,0 +1,122 @@
+package emailer
+
+import (
+	netmail "net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// redactedValue replaces secrets in log output
+const redactedValue = "********"
+
+// redactFormatter scrubs secrets from the message and fields of log entries
+// before formatting them
+type redactFormatter struct {
+	log.Formatter
+	replacer *strings.Replacer
+}
+
+// Format redacts the entry and formats it with the wrapped formatter
+func (f *redactFormatter) Format(entry *log.Entry) ([]byte, error) {
+	redacted := entry.Dup()
+	redacted.Level = entry.Level
+	redacted.Message = f.replacer.Replace(entry.Message)
+	for key, value := range entry.Data {
+		switch value := value.(type) {
+		case string:
+			redacted.Data[key] = f.replacer.Replace(value)
+		case error:
+			redacted.Data[key] = f.replacer.Replace(value.Error())
+		}
+	}
+	return f.Formatter.Format(redacted)
+}
+
+// secretParams matches the names of URL query parameters holding credentials
+var secretParams = []string{"key", "secret", "token", "password", "sig", "credential"}
+
+// URLCredentials returns the credentials embedded in the URL, the password
+// of the user info and the values of query parameters like access_key or
+// sas_token
+func URLCredentials(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+
+	var credentials []string
+	if password, ok := u.User.Password(); ok {
+		credentials = append(credentials, password)
+	}
+	for name, values := range u.Query() {
+		for _, secret := range secretParams {
+			if strings.Contains(strings.ToLower(name), secret) {
+				credentials = append(credentials, values...)
+				break
+			}
+		}
+	}
+	return credentials
+}
+
+// RedactSecrets scrubs the given secrets and the values of the given
+// environment variables from all log output, including their URL encoded
+// form used in connection strings
+func RedactSecrets(secrets []string, env []string) {
+	for _, name := range env {
+		secrets = append(secrets, os.Getenv(strings.TrimSpace(name)))
+	}
+
+	var pairs []string
+	for _, secret := range secrets {
+		secret = strings.TrimSpace(secret)
+		if secret == "" {
+			continue
+		}
+		pairs = append(pairs, secret, redactedValue)
+		if escaped := url.QueryEscape(secret); escaped != secret {
+			pairs = append(pairs, escaped, redactedValue)
+		}
+	}
+	if len(pairs) == 0 {
+		return
+	}
+
+	log.SetFormatter(&redactFormatter{
+		Formatter: log.StandardLogger().Formatter,
+		replacer:  strings.NewReplacer(pairs...),
+	})
+}
+
+// Logging modes of recipient addresses
+const (
+	LogRecipientsNone   = "none"
+	LogRecipientsMasked = "masked"
+	LogRecipientsFull   = "full"
+)
+
+// logRecipient returns the recipient as written to the log, masking the
+// local part of the address like j***@example.com unless configured
+// otherwise
+func (p Plugin) logRecipient(recipient string) string {
+	switch p.Config.LogRecipients {
+	case LogRecipientsFull:
+		return recipient
+	case LogRecipientsNone:
+		return redactedValue
+	}
+
+	if address, err := netmail.ParseAddress(recipient); err == nil {
+		recipient = address.Address
+	}
+	local, domain, ok := strings.Cut(recipient, "@")
+	if !ok || local == "" {
+		return redactedValue
+	}
+	_, size := utf8.DecodeRuneInString(local)
+	return local[:size] + "***@" + domain
+}
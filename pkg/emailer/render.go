@@ -0,0 +1,78 @@
+package emailer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aymerick/raymond"
+)
+
+// renderInline renders a template given inline as a setting value. Unlike
+// template.Render the value is never treated as a remote or file reference,
+// so settings like URLs can contain template expressions. Setting values are
+// plain text like addresses, paths and headers, so the expressions are not
+// HTML escaped.
+func renderInline(tpl string, ctx interface{}) (string, error) {
+	if !strings.Contains(tpl, "{{") {
+		return strings.TrimSpace(tpl), nil
+	}
+
+	out, err := raymond.Render(unescaped(tpl), ctx)
+	return strings.TrimSpace(out), err
+}
+
+// unescaped turns the expressions of the template into unescaped ones, so
+// {{ commit.author }} renders like {{& commit.author }}. Blocks, comments,
+// partials and expressions already unescaped are kept as is.
+func unescaped(tpl string) string {
+	var out strings.Builder
+	for {
+		i := strings.Index(tpl, "{{")
+		if i < 0 {
+			out.WriteString(tpl)
+			return out.String()
+		}
+		escaped := i > 0 && tpl[i-1] == '\\'
+		out.WriteString(tpl[:i+2])
+		tpl = tpl[i+2:]
+
+		open := strings.TrimPrefix(tpl, "~")
+		expr := strings.TrimLeft(open, " \t\r\n")
+		if escaped || expr == "" || strings.ContainsRune("{}&#/^!>*", rune(expr[0])) || isElse(expr) {
+			continue
+		}
+		out.WriteString(tpl[:len(tpl)-len(open)])
+		out.WriteString("&")
+		tpl = open
+	}
+}
+
+// isElse reports whether the expression is the else of a block
+func isElse(expr string) bool {
+	rest, ok := strings.CutPrefix(expr, "else")
+	return ok && (rest == "" || strings.ContainsRune(" \t\r\n}~", rune(rest[0])))
+}
+
+// appendFooter inserts the footer at the end of the body of the document
+func appendFooter(body, footer string) string {
+	return appendHTML(body, `<div class="footer">`+footer+`</div>`)
+}
+
+// appendHTML inserts the content at the end of the body of the document, or
+// appends it if the body is no complete HTML document
+func appendHTML(body, content string) string {
+	if i := strings.LastIndex(strings.ToLower(body), "</body>"); i >= 0 {
+		return body[:i] + content + "\n" + body[i:]
+	}
+	return body + "\n" + content
+}
+
+// tagSubject prepends a tag like [octocat/hello-world #42] to the subject,
+// unless the subject already contains it
+func (p Plugin) tagSubject(subject string) string {
+	tag := fmt.Sprintf("[%s #%d]", p.Repo.FullName, p.Build.Number)
+	if strings.Contains(strings.ToLower(subject), strings.ToLower(tag)) {
+		return subject
+	}
+	return tag + " " + subject
+}
@@ -0,0 +1,37 @@
+package emailer
+
+import "testing"
+
+func TestRenderInline(t *testing.T) {
+	ctx := map[string]interface{}{
+		"commit": map[string]interface{}{"author": "O'Brien & Co", "branch": "feat/a<b>"},
+		"list":   []string{"a&b", "c"},
+	}
+
+	tests := []struct {
+		tpl  string
+		want string
+	}{
+		{tpl: "plain & simple", want: "plain & simple"},
+		{tpl: "{{ commit.author }}", want: "O'Brien & Co"},
+		{tpl: "https://example.com/?a=1&b={{commit.branch}}", want: "https://example.com/?a=1&b=feat/a<b>"},
+		{tpl: "reports/{{~ commit.branch ~}}/x", want: "reports/feat/a<b>/x"},
+		{tpl: "{{{ commit.author }}}", want: "O'Brien & Co"},
+		{tpl: "{{& commit.author }}", want: "O'Brien & Co"},
+		{tpl: "{{#each list}}{{this}};{{/each}}", want: "a&b;c;"},
+		{tpl: "{{#if commit.tag}}{{commit.tag}}{{else}}{{commit.branch}}{{/if}}", want: "feat/a<b>"},
+		{tpl: "{{! a comment }}{{commit.author}}", want: "O'Brien & Co"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.tpl, func(t *testing.T) {
+			got, err := renderInline(test.tpl, ctx)
+			if err != nil {
+				t.Fatalf("renderInline() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("renderInline() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package emailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	mail "github.com/wneessen/go-mail"
+)
+
+type (
+	// deliveryReport describes the outcome of a run for later pipeline steps
+	deliveryReport struct {
+		Repo       string           `json:"repo"`
+		Build      int              `json:"build"`
+		Time       time.Time        `json:"time"`
+		Recipients int              `json:"recipients"`
+		Sent       int              `json:"sent"`
+		Failed     int              `json:"failed"`
+		Transient  int              `json:"transient"`
+		Permanent  int              `json:"permanent"`
+		Bytes      int64            `json:"bytes"`
+		Duration   int64            `json:"duration_ms"`
+		Error      string           `json:"error,omitempty"`
+		Deliveries []deliveryResult `json:"deliveries"`
+
+		started time.Time
+	}
+
+	// deliveryResult is the outcome of sending to a single recipient
+	deliveryResult struct {
+		Recipient string `json:"recipient"`
+		Status    string `json:"status"`
+		Class     string `json:"class,omitempty"`
+		Code      int    `json:"code,omitempty"`
+		MessageID string `json:"message_id,omitempty"`
+		Response  string `json:"response,omitempty"`
+		Error     string `json:"error,omitempty"`
+		Size      int64  `json:"size,omitempty"`
+		Attempts  int    `json:"attempts"`
+		Duration  int64  `json:"duration_ms"`
+	}
+)
+
+// Delivery status of a recipient in the report
+const (
+	DeliveryStatusSent   = "sent"
+	DeliveryStatusFailed = "failed"
+)
+
+// Classification of the failed deliveries in the report, temporary failures
+// may succeed when retried later
+const (
+	DeliveryClassTransient = "transient"
+	DeliveryClassPermanent = "permanent"
+)
+
+// newDeliveryReport starts the report for the given number of recipients
+func (p Plugin) newDeliveryReport(recipients int) *deliveryReport {
+	return &deliveryReport{
+		Repo:       p.Repo.FullName,
+		Build:      p.Build.Number,
+		Time:       time.Now().UTC(),
+		Recipients: recipients,
+		Deliveries: []deliveryResult{},
+		started:    time.Now(),
+	}
+}
+
+// add records the outcome of sending the message to the recipient
+func (r *deliveryReport) add(recipient string, msg *mail.Msg, duration time.Duration, attempts int, sendErr error) {
+	result := deliveryResult{
+		Recipient: recipient,
+		Status:    DeliveryStatusSent,
+		MessageID: msg.GetMessageID(),
+		Response:  msg.ServerResponse(),
+		Attempts:  attempts,
+		Duration:  duration.Milliseconds(),
+	}
+	if sendErr == nil {
+		// The server accepted the message data
+		result.Code = 250
+		result.Size, _ = msg.WriteTo(io.Discard)
+	} else {
+		result.Status = DeliveryStatusFailed
+		result.Error = sendErr.Error()
+		result.Class = DeliveryClassPermanent
+		if retryable(sendErr) {
+			result.Class = DeliveryClassTransient
+		}
+	}
+
+	var sendError *mail.SendError
+	if errors.As(sendErr, &sendError) {
+		result.Code = sendError.ErrorCode()
+	}
+	r.Deliveries = append(r.Deliveries, result)
+}
+
+// finish sums up the deliveries, recipients not sent to count as failed
+func (r *deliveryReport) finish() {
+	r.Sent, r.Bytes, r.Transient, r.Permanent = 0, 0, 0, 0
+	for _, result := range r.Deliveries {
+		switch {
+		case result.Status == DeliveryStatusSent:
+			r.Sent++
+			r.Bytes += result.Size
+		case result.Class == DeliveryClassPermanent:
+			r.Permanent++
+		default:
+			r.Transient++
+		}
+	}
+	r.Failed = r.Recipients - r.Sent
+	r.Duration = time.Since(r.started).Milliseconds()
+}
+
+// log writes the outcome of the run as a single summary line like "Sent 12/13
+// messages, 1 failed (b***@example.com 550), total 4.2 MB, 8.3s"
+func (r *deliveryReport) log(elapsed time.Duration) {
+	var failures []string
+	for _, result := range r.Deliveries {
+		switch {
+		case result.Status != DeliveryStatusFailed:
+		case result.Code != 0:
+			failures = append(failures, fmt.Sprintf("%s %d %s", result.Recipient, result.Code, result.Class))
+		default:
+			failures = append(failures, fmt.Sprintf("%s %s", result.Recipient, result.Class))
+		}
+	}
+	if r.Error != "" {
+		failures = append(failures, r.Error)
+	}
+
+	summary := fmt.Sprintf("Sent %d/%d messages", r.Sent, r.Recipients)
+	if r.Failed > 0 {
+		summary += fmt.Sprintf(", %d failed (%s)", r.Failed, strings.Join(failures, ", "))
+	}
+	summary += fmt.Sprintf(", total %s, %s", formatSize(r.Bytes), round(elapsed))
+
+	entry := log.WithFields(log.Fields{
+		"recipients": r.Recipients,
+		"sent":       r.Sent,
+		"failed":     r.Failed,
+		"bytes":      r.Bytes,
+		"duration":   elapsed.Milliseconds(),
+	})
+	if r.Failed > 0 {
+		entry.Error(summary)
+		return
+	}
+	entry.Info(summary)
+}
+
+// writeReport writes the report to the configured report file
+func (p Plugin) writeReport(r *deliveryReport) error {
+	if p.Config.ReportFile == "" {
+		return nil
+	}
+
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r); err != nil {
+		return err
+	}
+	return os.WriteFile(p.Config.ReportFile, data.Bytes(), 0o644)
+}
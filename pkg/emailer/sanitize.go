@@ -0,0 +1,23 @@
+package emailer
+
+import (
+	"html"
+)
+
+// sanitizeCommit escapes HTML in the commit fields controlled by the author
+// before they are exposed to the HTML body, so templates inserting them
+// unescaped can't be abused to inject markup
+func sanitizeCommit(commit Commit) Commit {
+	commit.Message = html.EscapeString(commit.Message)
+	commit.Author.Name = html.EscapeString(commit.Author.Name)
+	commit.Author.Email = html.EscapeString(commit.Author.Email)
+	commit.Branch = html.EscapeString(commit.Branch)
+	commit.Ref = html.EscapeString(commit.Ref)
+	return commit
+}
+
+// sanitizeTag escapes HTML in the tag name, which is chosen by whoever
+// pushes the tag
+func sanitizeTag(tag string) string {
+	return html.EscapeString(tag)
+}
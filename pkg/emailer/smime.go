@@ -0,0 +1,77 @@
+package emailer
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// smimeCertificate returns the certificate and key messages are signed with,
+// either loaded from PEM encoded certificate and key or a PKCS#12 bundle.
+// It returns nil if S/MIME signing is not configured.
+func (p Plugin) smimeCertificate() (*tls.Certificate, error) {
+	switch {
+	case p.Config.SMIMEPKCS12 != "":
+		data, err := os.ReadFile(p.Config.SMIMEPKCS12)
+		if err != nil {
+			// bundles passed as secrets are base64 encoded
+			if data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(p.Config.SMIMEPKCS12)); err != nil {
+				return nil, fmt.Errorf("could not decode pkcs12 bundle: %w", err)
+			}
+		}
+
+		blocks, err := pkcs12.ToPEM(data, p.Config.SMIMEPassword)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode pkcs12 bundle: %w", err)
+		}
+		var certs, key []byte
+		for _, block := range blocks {
+			if block.Type == "CERTIFICATE" {
+				certs = append(certs, pem.EncodeToMemory(block)...)
+			} else {
+				key = pem.EncodeToMemory(block)
+			}
+		}
+
+		cert, err := tls.X509KeyPair(certs, key)
+		if err != nil {
+			return nil, err
+		}
+		return &cert, nil
+
+	case p.Config.SMIMECertificate != "" || p.Config.SMIMEKey != "":
+		certs, err := readSecret(p.Config.SMIMECertificate)
+		if err != nil {
+			return nil, err
+		}
+		key, err := readSecret(p.Config.SMIMEKey)
+		if err != nil {
+			return nil, err
+		}
+
+		cert, err := tls.X509KeyPair(certs, key)
+		if err != nil {
+			return nil, err
+		}
+		return &cert, nil
+	}
+
+	return nil, nil
+}
+
+// readSecret returns the value of a setting which is either the content
+// itself, e.g. passed as secret, or the path of a file holding it
+func readSecret(value string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return []byte(value), nil
+	}
+	if _, err := os.Stat(value); err != nil {
+		return []byte(value), nil
+	}
+	return os.ReadFile(value)
+}
@@ -0,0 +1,209 @@
+package emailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	mail "github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail/smtp"
+)
+
+// spoolEnvelope is stored next to a spooled message, the message is sent
+// as is to keep signatures intact
+type spoolEnvelope struct {
+	From     string    `json:"from"`
+	To       []string  `json:"to"`
+	Repo     string    `json:"repo"`
+	Build    int       `json:"build"`
+	Spooled  time.Time `json:"spooled"`
+	Attempts int       `json:"attempts"`
+}
+
+// retryable reports whether sending may succeed on a later attempt, which
+// is the case unless the server rejected the message permanently
+func retryable(err error) bool {
+	return replyCode(err) < 500
+}
+
+// replyCode returns the SMTP reply code of the error, or 0 if the server did
+// not reply e.g. because the connection was lost
+func replyCode(err error) int {
+	var sendErr *mail.SendError
+	if errors.As(err, &sendErr) {
+		return sendErr.ErrorCode()
+	}
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code
+	}
+	return 0
+}
+
+// spool saves the message to the spool directory to be sent by the next run
+func (p Plugin) spool(recipient string, msg *mail.Msg) error {
+	if err := os.MkdirAll(p.Config.SpoolDir, 0o700); err != nil {
+		return err
+	}
+
+	from, err := msg.GetSender(false)
+	if err != nil {
+		return err
+	}
+	to, err := msg.GetRecipients()
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Join(p.Config.SpoolDir, fmt.Sprintf("%d-%s", time.Now().UnixNano(), strings.TrimSuffix(emlName(recipient), ".eml")))
+	f, err := os.OpenFile(name+".eml", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := msg.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// The envelope is written last, marking the message as complete
+	return writeEnvelope(name+".json", spoolEnvelope{
+		From:    from,
+		To:      to,
+		Repo:    p.Repo.FullName,
+		Build:   p.Build.Number,
+		Spooled: time.Now().UTC(),
+	})
+}
+
+// spoolAll builds and spools the messages of all recipients, e.g. when the
+// SMTP server could not be reached
+func (p Plugin) spoolAll(recipients map[string]struct{}, content message) {
+	spooled := 0
+	for recipient := range recipients {
+		msg, err := p.newMessage(recipient, content)
+		if err == nil {
+			err = p.spool(recipient, msg)
+		}
+		if err != nil {
+			log.Errorf("Could not spool email to %q: %v", p.logRecipient(recipient), err)
+			continue
+		}
+		spooled++
+	}
+	log.Infof("Spooled %d messages for the next run", spooled)
+}
+
+// flushSpool sends the messages spooled by previous runs over a separate
+// connection. Messages failing again are kept unless rejected permanently,
+// errors never fail the current run.
+func (p Plugin) flushSpool(ctx context.Context) {
+	envelopes, err := filepath.Glob(filepath.Join(p.Config.SpoolDir, "*.json"))
+	if err != nil || len(envelopes) == 0 {
+		return
+	}
+	sort.Strings(envelopes)
+	log.Infof("Sending %d spooled messages", len(envelopes))
+
+	client, err := p.newClient()
+	if err != nil {
+		log.Warnf("Could not send spooled messages: %v", err)
+		return
+	}
+	smtpClient, err := client.DialToSMTPClientWithContext(ctx)
+	if err != nil {
+		log.Warnf("Could not send spooled messages: %v", err)
+		return
+	}
+	defer client.CloseWithSMTPClient(smtpClient)
+
+	sent := 0
+	for _, path := range envelopes {
+		if ctx.Err() != nil {
+			break
+		}
+		name := strings.TrimSuffix(path, ".json")
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Warnf("Could not read spooled message %s: %v", name, err)
+			continue
+		}
+		var envelope spoolEnvelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			log.Warnf("Could not read spooled message %s: %v", name, err)
+			continue
+		}
+		raw, err := os.ReadFile(name + ".eml")
+		if err != nil {
+			log.Warnf("Could not read spooled message %s: %v", name, err)
+			continue
+		}
+
+		err = sendRaw(smtpClient, envelope, raw)
+		switch {
+		case err == nil:
+			sent++
+			os.Remove(name + ".eml")
+			os.Remove(path)
+			continue
+		case !retryable(err):
+			log.Errorf("Dropping spooled message of %s #%d: %v", envelope.Repo, envelope.Build, err)
+			os.Remove(name + ".eml")
+			os.Remove(path)
+		default:
+			log.Warnf("Could not send spooled message of %s #%d, keeping it: %v", envelope.Repo, envelope.Build, err)
+			envelope.Attempts++
+			if err := writeEnvelope(path, envelope); err != nil {
+				log.Warnf("Could not update spooled message %s: %v", name, err)
+			}
+		}
+
+		// Abort the failed transaction before the next message
+		if err := smtpClient.Reset(); err != nil {
+			log.Warnf("Could not send spooled messages: %v", err)
+			break
+		}
+	}
+	log.Infof("Sent %d of %d spooled messages", sent, len(envelopes))
+}
+
+// sendRaw sends the spooled message data unchanged
+func sendRaw(c *smtp.Client, envelope spoolEnvelope, raw []byte) error {
+	if err := c.Mail(envelope.From); err != nil {
+		return err
+	}
+	for _, to := range envelope.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// writeEnvelope writes the envelope of a spooled message
+func writeEnvelope(path string, envelope spoolEnvelope) error {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
@@ -0,0 +1,34 @@
+package emailer
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+)
+
+func TestReplyCode(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		code      int
+		retryable bool
+	}{
+		{name: "no reply", err: errors.New("connection reset by peer"), code: 0, retryable: true},
+		{name: "temporary", err: &textproto.Error{Code: 451, Msg: "try again later"}, code: 451, retryable: true},
+		{name: "greylisted", err: &textproto.Error{Code: 421, Msg: "closing connection"}, code: 421, retryable: true},
+		{name: "permanent", err: &textproto.Error{Code: 550, Msg: "no such user"}, code: 550, retryable: false},
+		{name: "wrapped", err: fmt.Errorf("send: %w", &textproto.Error{Code: 552, Msg: "too big"}), code: 552, retryable: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code := replyCode(test.err); code != test.code {
+				t.Errorf("replyCode() = %d, want %d", code, test.code)
+			}
+			if retryable := retryable(test.err); retryable != test.retryable {
+				t.Errorf("retryable() = %v, want %v", retryable, test.retryable)
+			}
+		})
+	}
+}
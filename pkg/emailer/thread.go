@@ -0,0 +1,70 @@
+package emailer
+
+import (
+	"crypto/rand"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// unsafeIDChars are replaced in the local part of generated Message-IDs
+var unsafeIDChars = regexp.MustCompile(`[^a-z0-9.]+`)
+
+// thread identifies the conversation a message belongs to
+type thread struct {
+	MessageID string
+	Root      string
+}
+
+// thread returns the Message-ID of the message and the id of the thread root
+// referenced by every message of the same repository and branch, or the same
+// pull request for pull request events, so clients group successive
+// notifications into a single conversation. The thread root is never sent
+// itself.
+func (p Plugin) thread(ctx interface{}) (*thread, error) {
+	if !p.Config.Thread {
+		return nil, nil
+	}
+
+	key := fmt.Sprintf("ci-%s-%s-%s", p.Repo.Owner, p.Repo.Name, p.Commit.Branch)
+	if p.Build.Event == "pull_request" && p.PullRequest > 0 {
+		key = fmt.Sprintf("ci-%s-%s-pr-%d", p.Repo.Owner, p.Repo.Name, p.PullRequest)
+	}
+	if p.Config.ThreadKey != "" {
+		var err error
+		if key, err = renderInline(p.Config.ThreadKey, ctx); err != nil {
+			return nil, err
+		}
+	}
+	key = strings.Trim(unsafeIDChars.ReplaceAllString(strings.ToLower(key), "-"), "-")
+
+	domain := p.messageIDDomain()
+	return &thread{
+		MessageID: fmt.Sprintf("%s.%d.%d@%s", key, p.Build.Number, int64(p.Build.Started), domain),
+		Root:      fmt.Sprintf("%s@%s", key, domain),
+	}, nil
+}
+
+// messageID returns a random Message-ID using the configured domain, or an
+// empty string to keep the default of the hostname
+func (p Plugin) messageID() string {
+	if p.Config.MessageIDDomain == "" {
+		return ""
+	}
+
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return fmt.Sprintf("%x@%s", id, p.messageIDDomain())
+}
+
+// messageIDDomain returns the domain of generated Message-IDs, which is the
+// configured domain or the domain of the from address
+func (p Plugin) messageIDDomain() string {
+	if p.Config.MessageIDDomain != "" {
+		return strings.ToLower(p.Config.MessageIDDomain)
+	}
+	if _, domain, ok := strings.Cut(p.Config.FromAddress, "@"); ok && domain != "" {
+		return strings.ToLower(strings.TrimSuffix(domain, ">"))
+	}
+	return "drone"
+}
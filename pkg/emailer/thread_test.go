@@ -0,0 +1,36 @@
+package emailer
+
+import "testing"
+
+func TestThreadRoot(t *testing.T) {
+	ctx := map[string]interface{}{
+		"repo":   map[string]interface{}{"owner": "octocat", "name": "hello-world"},
+		"commit": map[string]interface{}{"branch": "fix/a<b>&c"},
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{name: "default", want: "ci-octocat-hello-world-fix-a-b-c@example.com"},
+		{name: "templated", key: "ci-{{ repo.owner }}-{{ repo.name }}-{{ commit.branch }}", want: "ci-octocat-hello-world-fix-a-b-c@example.com"},
+		{name: "per repository", key: "{{ repo.owner }}/{{ repo.name }}", want: "octocat-hello-world@example.com"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Plugin{Config: Config{Thread: true, ThreadKey: test.key, FromAddress: "ci@example.com"}}
+			p.Repo.Owner, p.Repo.Name = "octocat", "hello-world"
+			p.Commit.Branch = "fix/a<b>&c"
+
+			thread, err := p.thread(ctx)
+			if err != nil {
+				t.Fatalf("thread() error = %v", err)
+			}
+			if thread.Root != test.want {
+				t.Errorf("thread() root = %q, want %q", thread.Root, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type (
+	// timings records the duration of the phases of a run, in order of
+	// their first start
+	timings struct {
+		started time.Time
+
+		// mu guards the phases, sent concurrently
+		mu     sync.Mutex
+		phases []*phaseTiming
+	}
+
+	// phaseTiming sums up the runs of a phase, e.g. all sends
+	phaseTiming struct {
+		name  string
+		count int
+		total time.Duration
+		max   time.Duration
+	}
+
+	// phase is a running phase of the send pipeline, traced as span
+	phase struct {
+		trace.Span
+		name    string
+		started time.Time
+		timings *timings
+	}
+)
+
+// newTimings starts recording the timings of a run
+func newTimings() *timings {
+	return &timings{started: time.Now()}
+}
+
+// start starts the named phase and its span
+func (t *timings) start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, *phase) {
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+	return ctx, &phase{
+		Span:    span,
+		name:    name,
+		started: time.Now(),
+		timings: t,
+	}
+}
+
+// end ends the phase and its span, marking the span as failed on error
+func (ph *phase) end(err error) {
+	endSpan(ph.Span, err)
+	ph.timings.add(ph.name, time.Since(ph.started))
+}
+
+// add records a run of the named phase
+func (t *timings) add(name string, duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var timing *phaseTiming
+	for _, existing := range t.phases {
+		if existing.name == name {
+			timing = existing
+		}
+	}
+	if timing == nil {
+		timing = &phaseTiming{name: name}
+		t.phases = append(t.phases, timing)
+	}
+	timing.count++
+	timing.total += duration
+	timing.max = max(timing.max, duration)
+}
+
+// log writes the timing breakdown of the run as a single entry, with the
+// durations in milliseconds as fields
+func (t *timings) log() {
+	total := time.Since(t.started)
+	fields := log.Fields{"duration": total.Milliseconds()}
+
+	var parts []string
+	for _, timing := range t.phases {
+		key := strings.ReplaceAll(timing.name, " ", "_")
+		fields[key] = timing.total.Milliseconds()
+		if timing.count > 1 {
+			fields[key+"_count"] = timing.count
+			fields[key+"_max"] = timing.max.Milliseconds()
+			parts = append(parts, fmt.Sprintf("%s %dx %s (max %s)", timing.name, timing.count, round(timing.total), round(timing.max)))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s %s", timing.name, round(timing.total)))
+	}
+	parts = append(parts, "total "+round(total).String())
+
+	log.WithFields(fields).Infof("Timing: %s", strings.Join(parts, ", "))
+}
+
+// round rounds the duration for display
+func round(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(100 * time.Millisecond)
+}
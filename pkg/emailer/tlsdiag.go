@@ -0,0 +1,122 @@
+package emailer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tlsDiagnostics connects to the SMTP server to report why a TLS secured
+// connection could not be established, including the server banner, the
+// supported extensions and a summary of the certificate chain
+func (p Plugin) tlsDiagnostics() string {
+	var report strings.Builder
+	addr := net.JoinHostPort(p.Config.Host, strconv.Itoa(p.Config.Port))
+	fmt.Fprintf(&report, "TLS diagnostics for %s:\n", addr)
+
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		fmt.Fprintf(&report, "  connect: %v\n", err)
+		return report.String()
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	text := textproto.NewConn(conn)
+	_, banner, err := text.ReadResponse(220)
+	if err != nil {
+		fmt.Fprintf(&report, "  banner: %v\n", err)
+		return report.String()
+	}
+	fmt.Fprintf(&report, "  banner: %s\n", banner)
+
+	hostname := p.Config.ClientHostname
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	id, err := text.Cmd("EHLO %s", hostname)
+	if err != nil {
+		fmt.Fprintf(&report, "  ehlo: %v\n", err)
+		return report.String()
+	}
+	text.StartResponse(id)
+	_, ehlo, err := text.ReadResponse(250)
+	text.EndResponse(id)
+	if err != nil {
+		fmt.Fprintf(&report, "  ehlo: %v\n", err)
+		return report.String()
+	}
+
+	// the first line of the response greets the client
+	extensions := strings.Split(ehlo, "\n")[1:]
+	fmt.Fprintf(&report, "  extensions: %s\n", strings.Join(extensions, ", "))
+
+	starttls := false
+	for _, extension := range extensions {
+		if strings.EqualFold(strings.TrimSpace(extension), "STARTTLS") {
+			starttls = true
+		}
+	}
+	if !starttls {
+		report.WriteString("  starttls: not advertised by the server, the connection may be downgraded by a man in the middle\n")
+		return report.String()
+	}
+
+	id, err = text.Cmd("STARTTLS")
+	if err != nil {
+		fmt.Fprintf(&report, "  starttls: %v\n", err)
+		return report.String()
+	}
+	text.StartResponse(id)
+	_, _, err = text.ReadResponse(220)
+	text.EndResponse(id)
+	if err != nil {
+		fmt.Fprintf(&report, "  starttls: %v\n", err)
+		return report.String()
+	}
+
+	// Accept any certificate to be able to describe it
+	client := tls.Client(conn, &tls.Config{
+		ServerName:         p.Config.Host,
+		InsecureSkipVerify: true, //nolint:gosec
+	})
+	if err := client.Handshake(); err != nil {
+		fmt.Fprintf(&report, "  handshake: %v\n", err)
+		return report.String()
+	}
+
+	state := client.ConnectionState()
+	fmt.Fprintf(&report, "  tls: %s, %s\n", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	for i, cert := range state.PeerCertificates {
+		fmt.Fprintf(&report, "  certificate %d: subject %q, issuer %q, valid %s to %s",
+			i, cert.Subject.String(), cert.Issuer.String(),
+			cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+		if len(cert.DNSNames) > 0 {
+			fmt.Fprintf(&report, ", names %s", strings.Join(cert.DNSNames, ", "))
+		}
+		report.WriteString("\n")
+	}
+
+	if len(state.PeerCertificates) > 0 {
+		intermediates := x509.NewCertPool()
+		for _, cert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+			DNSName:       p.Config.Host,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			fmt.Fprintf(&report, "  verification: %v\n", err)
+		} else {
+			report.WriteString("  verification: ok\n")
+		}
+	}
+
+	return report.String()
+}
@@ -0,0 +1,81 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the send pipeline, which are discarded unless
+// tracing is configured
+var tracer = otel.Tracer("github.com/drone-plugins/drone-email")
+
+// startTracing exports the spans to the configured OTLP endpoint. The
+// returned function flushes the remaining spans.
+func (p Plugin) startTracing() (func(), error) {
+	if p.Config.OTLPEndpoint == "" {
+		return func() {}, nil
+	}
+
+	// The endpoint is the base URL of the collector like
+	// OTEL_EXPORTER_OTLP_ENDPOINT
+	u, err := url.Parse(p.Config.OTLPEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid otlp endpoint: %w", err)
+	}
+
+	headers := make(map[string]string)
+	for _, header := range p.Config.OTLPHeaders {
+		name, value, ok := strings.Cut(header, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid otlp header %q, expected name=value", header)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(u.JoinPath("v1", "traces").String()),
+		otlptracehttp.WithHeaders(headers),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "drone-email"),
+			attribute.String("drone.repo", p.Repo.FullName),
+			attribute.Int("drone.build", p.Build.Number),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			log.Warnf("Could not export traces: %v", err)
+		}
+	}, nil
+}
+
+// endSpan ends the span, marking it as failed on error
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,200 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+	netmail "net/mail"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	mail "github.com/wneessen/go-mail"
+)
+
+// Validate renders the subject, body and footer templates without build
+// data, reporting syntax errors
+func (p Plugin) Validate() error {
+	templates := []struct {
+		name, template string
+	}{
+		{"subject", p.Config.Subject},
+		{"body", p.Config.Body},
+		{"text body", p.Config.TextBody},
+		{"footer", p.Config.Footer},
+	}
+
+	for _, t := range templates {
+		if t.template == "" {
+			continue
+		}
+		if _, err := p.renderer(context.Background()).Render(t.template, map[string]interface{}{}); err != nil {
+			return fmt.Errorf("invalid %s template: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// ConfigError reports all problems of the settings found by ValidateConfig
+type ConfigError struct {
+	Problems []error
+}
+
+func (e *ConfigError) Error() string {
+	if len(e.Problems) == 1 {
+		return fmt.Sprintf("invalid setting %v", e.Problems[0])
+	}
+	return fmt.Sprintf("invalid settings, %d problems found", len(e.Problems))
+}
+
+func (e *ConfigError) Unwrap() []error {
+	return e.Problems
+}
+
+// ValidateConfig checks the effective settings before anything is rendered
+// or sent, reporting all problems at once as ConfigError
+func (p Plugin) ValidateConfig() error {
+	// Relays accepting a username without password keep working, they are
+	// not authenticated as before
+	if (p.Config.Username == "") != (p.Config.Password == "") {
+		log.Warn("Not authenticating to the SMTP server as only one of username and password is set")
+	}
+
+	if problems := p.configProblems(); len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// configProblems returns the problems of the settings, each naming the
+// setting and how to fix it
+func (p Plugin) configProblems() []error {
+	var problems []error
+	problem := func(setting, format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf("%s: %s", setting, fmt.Sprintf(format, args...)))
+	}
+
+	// The SMTP server is only needed when sending
+	if !p.Config.DryRun && p.Config.Preview == "" && p.Sender == nil {
+		if p.Config.Host == "" {
+			problem("host", "not set, set the SMTP server e.g. smtp.example.com")
+		}
+		if p.Config.Port < 1 || p.Config.Port > 65535 {
+			problem("port", "%d is out of range, use 587 for STARTTLS or 25", p.Config.Port)
+		}
+		if p.Config.NoStartTLS && p.Config.TLSRequired {
+			problem("no_starttls", "conflicts with tls_required, disable one of them")
+		}
+		if p.Config.Retries < 0 {
+			problem("retries", "%d is negative, use 0 to not retry temporary failures", p.Config.Retries)
+		}
+		if p.Config.MessagesPerConn < 0 {
+			problem("messages_per_connection", "%d is negative, remove the setting to send all messages over a connection", p.Config.MessagesPerConn)
+		}
+		if p.Config.Concurrency < 0 {
+			problem("concurrency", "%d is negative, use 1 to send over a single connection", p.Config.Concurrency)
+		}
+	}
+
+	if p.Config.Aggregate {
+		switch {
+		case p.Config.AggregateDir == "" && p.Config.APIServer == "":
+			problem("aggregate", "needs aggregate_dir shared by the jobs or api_server to wait for the other jobs")
+		case p.Config.AggregateDir != "" && p.Config.AggregateJobs < 1:
+			problem("aggregate_jobs", "not set, set the number of jobs recording their outcome in aggregate_dir")
+		}
+	}
+
+	if p.Config.Delivery == DeliveryBatch {
+		if p.Config.VERP != "" {
+			problem("delivery", "batch conflicts with verp, which needs a message per recipient")
+		}
+		if p.Config.PGPKeyring != "" {
+			problem("delivery", "batch conflicts with pgp_keyring, which needs a message per recipient")
+		}
+		if p.Config.BatchSize < 0 {
+			problem("batch_size", "%d is negative, remove the setting to send up to 100 recipients a message", p.Config.BatchSize)
+		}
+	}
+
+	if p.Config.Digest != "" && p.Config.DigestDir == "" {
+		problem("digest_dir", "not set, set the directory shared by the builds collected for the digest")
+	}
+
+	switch {
+	case p.Config.FromAddress == "":
+		problem("from.address", "not set, set the sender address e.g. ci@example.com")
+	case !strings.Contains(p.Config.FromAddress, "{{"):
+		if _, err := netmail.ParseAddress(p.Config.FromAddress); err != nil {
+			problem("from.address", "%q is not a valid address (%v), use the plain address and from.name for the name", p.Config.FromAddress, err)
+		}
+	}
+
+	if p.Resolver == nil {
+		if p.Config.RecipientsOnly && len(p.Config.Recipients) == 0 && p.Config.RecipientsFile == "" {
+			problem("recipients", "none set while recipients_only is enabled, set recipients or recipients_file")
+		}
+		for _, recipient := range p.Config.Recipients {
+			if _, err := netmail.ParseAddress(recipient); recipient != "" && err != nil {
+				problem("recipients", "%q is not a valid address (%v)", recipient, err)
+			}
+		}
+	}
+
+	if strings.TrimSpace(p.Config.Subject) == "" {
+		problem("subject", "empty, remove the setting to use the default subject")
+	}
+	if p.Config.Format == FormatText && strings.TrimSpace(p.Config.TextBody) == "" {
+		problem("text_body", "empty, remove the setting to use the default text template")
+	}
+	if p.Config.TextWidth < 0 {
+		problem("text_width", "%d is negative, remove the setting to not wrap the plain text", p.Config.TextWidth)
+	}
+	if strings.TrimSpace(p.Config.Body) == "" {
+		problem("body", "empty, remove the setting to use the default template")
+	}
+
+	for _, setting := range []struct {
+		name, value string
+		values      []string
+	}{
+		{"oversize_action", p.Config.OversizeAction, []string{OversizeSkip, OversizeFail}},
+		{"compress_attachments", p.Config.CompressAttachments, []string{CompressNone, CompressGzip, CompressZip}},
+		{"log_recipients", p.Config.LogRecipients, []string{LogRecipientsNone, LogRecipientsMasked, LogRecipientsFull}},
+		{"preflight", p.Config.Preflight, []string{PreflightOff, PreflightWarn, PreflightFail}},
+		{"digest", p.Config.Digest, []string{DigestCollect, DigestSend}},
+		{"mailbox_format", p.Config.MailboxFormat, []string{MailboxMbox, MailboxMaildir}},
+		{"delivery", p.Config.Delivery, []string{DeliveryIndividual, DeliveryBatch}},
+		{"format", p.Config.Format, []string{FormatMultipart, FormatText, FormatHTML}},
+		{"text_links", p.Config.TextLinks, []string{TextLinksInline, TextLinksFootnotes, TextLinksOmit}},
+		{"text_tables", p.Config.TextTables, []string{TextTablesPlain, TextTablesPretty}},
+	} {
+		if setting.value != "" && !slices.Contains(setting.values, setting.value) {
+			problem(setting.name, "unknown value %q, use one of %s", setting.value, strings.Join(setting.values, ", "))
+		}
+	}
+
+	for _, setting := range []struct{ name, value string }{
+		{"attach_dir_max_size", p.Config.AttachDirMaxSize},
+		{"max_attachment_size", p.Config.MaxAttachmentSize},
+		{"max_message_size", p.Config.MaxMessageSize},
+		{"download_max_size", p.Config.DownloadMaxSize},
+	} {
+		if _, err := parseSize(setting.value); err != nil {
+			problem(setting.name, "%v, use a size like 512KB or 10MB", err)
+		}
+	}
+
+	if _, err := p.charset(); err != nil {
+		problem("charset", "%v, use a MIME charset like UTF-8 or ISO-8859-1", err)
+	}
+	if _, err := transferEncoding(p.Config.BodyEncoding, mail.EncodingQP); err != nil {
+		problem("body_encoding", "%v, use quoted-printable, base64 or 8bit", err)
+	}
+	if encoding, err := transferEncoding(p.Config.AttachmentEncoding, mail.EncodingB64); err != nil {
+		problem("attachment_encoding", "%v, use base64", err)
+	} else if encoding == mail.EncodingQP {
+		problem("attachment_encoding", "attachments can't be encoded as quoted-printable, use base64")
+	}
+
+	return problems
+}
@@ -0,0 +1,102 @@
+package emailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigProblems(t *testing.T) {
+	base := Config{
+		Host:        "smtp.example.com",
+		Port:        587,
+		FromAddress: "ci@example.com",
+		Subject:     DefaultSubject,
+		Body:        DefaultTemplate,
+		TextBody:    DefaultTextTemplate,
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string
+	}{
+		{
+			name:   "valid",
+			modify: func(c *Config) {},
+		},
+		{
+			name:   "missing host",
+			modify: func(c *Config) { c.Host = "" },
+			want:   []string{"host: not set"},
+		},
+		{
+			name:   "host not needed for dry runs",
+			modify: func(c *Config) { c.Host, c.Port, c.DryRun = "", 0, true },
+		},
+		{
+			name:   "port out of range",
+			modify: func(c *Config) { c.Port = 70000 },
+			want:   []string{"port: 70000 is out of range"},
+		},
+		{
+			name:   "username without password",
+			modify: func(c *Config) { c.Username = "relay" },
+		},
+		{
+			name:   "invalid sender",
+			modify: func(c *Config) { c.FromAddress = "ci.example.com" },
+			want:   []string{"from.address:"},
+		},
+		{
+			name:   "templated sender",
+			modify: func(c *Config) { c.FromAddress = "{{ commit.author.email }}" },
+		},
+		{
+			name:   "recipients only without recipients",
+			modify: func(c *Config) { c.RecipientsOnly = true },
+			want:   []string{"recipients: none set"},
+		},
+		{
+			name:   "invalid recipient",
+			modify: func(c *Config) { c.Recipients = []string{"jane"} },
+			want:   []string{`recipients: "jane" is not a valid address`},
+		},
+		{
+			name:   "batch delivery with verp",
+			modify: func(c *Config) { c.Delivery, c.VERP = DeliveryBatch, "bounce@example.com" },
+			want:   []string{"delivery: batch conflicts with verp"},
+		},
+		{
+			name:   "unknown value",
+			modify: func(c *Config) { c.CompressAttachments = "bzip2" },
+			want:   []string{`compress_attachments: unknown value "bzip2"`},
+		},
+		{
+			name:   "invalid size",
+			modify: func(c *Config) { c.MaxMessageSize = "ten" },
+			want:   []string{"max_message_size: invalid size"},
+		},
+		{
+			name:   "all problems reported",
+			modify: func(c *Config) { c.Host, c.Subject, c.Charset = "", " ", "klingon" },
+			want:   []string{"host:", "subject: empty", "charset: unsupported charset"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := base
+			test.modify(&config)
+
+			problems := Plugin{Config: config}.configProblems()
+			if len(problems) != len(test.want) {
+				t.Fatalf("configProblems() = %v, want %d problems", problems, len(test.want))
+			}
+			for i, want := range test.want {
+				if !strings.HasPrefix(problems[i].Error(), want) {
+					t.Errorf("configProblems()[%d] = %q, want prefix %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
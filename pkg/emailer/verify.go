@@ -0,0 +1,57 @@
+package emailer
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// verifyRecipients issues RCPT TO for every recipient in a transaction that
+// is reset afterwards, and removes the recipients the server rejects
+// permanently. Connection problems are logged and leave the recipients
+// unchanged, as they fail the delivery anyway.
+func (p Plugin) verifyRecipients(ctx context.Context, recipients map[string]struct{}) error {
+	client, err := p.newClient()
+	if err != nil {
+		return err
+	}
+	smtpClient, err := client.DialToSMTPClientWithContext(ctx)
+	if err != nil {
+		log.Warnf("Could not verify recipients: %v", err)
+		return nil
+	}
+	defer client.CloseWithSMTPClient(smtpClient)
+
+	from := p.Config.EnvelopeFrom
+	if from == "" {
+		from = p.Config.FromAddress
+	}
+	if err := smtpClient.Mail(pathAddress(from)); err != nil {
+		log.Warnf("Could not verify recipients: %v", err)
+		return nil
+	}
+
+	for _, recipient := range slices.Sorted(maps.Keys(recipients)) {
+		err := smtpClient.Rcpt(pathAddress(recipient))
+		switch {
+		case err == nil:
+		case replyCode(err) >= 500:
+			log.Warnf("Removing recipient %q rejected by the server: %v", p.logRecipient(recipient), err)
+			delete(recipients, recipient)
+		default:
+			log.Warnf("Could not verify recipient %q, keeping it: %v", p.logRecipient(recipient), err)
+		}
+	}
+
+	if err := smtpClient.Reset(); err != nil {
+		log.Warnf("Could not reset the verification transaction: %v", err)
+	}
+
+	if len(recipients) == 0 {
+		return fmt.Errorf("all recipients were rejected by the server")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package emailer
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	mail "github.com/wneessen/go-mail"
+)
+
+// Version is the version of the plugin, set when building a release with
+// -ldflags "-X github.com/drone-plugins/drone-email/pkg/emailer.Version=2.1.0"
+var Version = "2.0.2"
+
+// BuildInfo identifies the build of the plugin
+type BuildInfo struct {
+	Version string
+	Commit  string
+	GoMail  string
+	Go      string
+}
+
+// ReadBuildInfo returns the version of the plugin, the commit it was built
+// from if known and the versions of go-mail and Go
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version: Version,
+		GoMail:  mail.VERSION,
+		Go:      runtime.Version(),
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		var modified bool
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+				if len(info.Commit) > 12 {
+					info.Commit = info.Commit[:12]
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if modified && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	}
+	return info
+}
+
+// String returns the build info like 2.0.2 (commit 0123456789ab, go-mail
+// 0.7.2, go1.24.0)
+func (b BuildInfo) String() string {
+	commit := b.Commit
+	if commit == "" {
+		commit = "unknown"
+	}
+	return fmt.Sprintf("%s (commit %s, go-mail %s, %s)", b.Version, commit, b.GoMail, b.Go)
+}
+
+// UserAgent returns the X-Mailer and User-Agent header value identifying the
+// build of the plugin
+func (b BuildInfo) UserAgent() string {
+	if b.Commit == "" {
+		return fmt.Sprintf("drone-email/%s go-mail/%s", b.Version, b.GoMail)
+	}
+	return fmt.Sprintf("drone-email/%s (%s) go-mail/%s", b.Version, b.Commit, b.GoMail)
+}
@@ -0,0 +1,244 @@
+package emailer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// webhookRequest is the payload of a Drone or Harness CI webhook
+	webhookRequest struct {
+		Event  string        `json:"event"`
+		Action string        `json:"action"`
+		Repo   webhookRepo   `json:"repo"`
+		Build  webhookBuild  `json:"build"`
+		System webhookSystem `json:"system"`
+	}
+
+	webhookRepo struct {
+		Namespace     string `json:"namespace"`
+		Name          string `json:"name"`
+		Slug          string `json:"slug"`
+		SCM           string `json:"scm"`
+		HTTPURL       string `json:"git_http_url"`
+		Link          string `json:"link"`
+		DefaultBranch string `json:"default_branch"`
+		Private       bool   `json:"private"`
+		Trusted       bool   `json:"trusted"`
+	}
+
+	webhookBuild struct {
+		Number       int    `json:"number"`
+		Status       string `json:"status"`
+		Event        string `json:"event"`
+		Link         string `json:"link"`
+		Message      string `json:"message"`
+		Before       string `json:"before"`
+		After        string `json:"after"`
+		Ref          string `json:"ref"`
+		Target       string `json:"target"`
+		AuthorName   string `json:"author_name"`
+		AuthorEmail  string `json:"author_email"`
+		AuthorAvatar string `json:"author_avatar"`
+		Deploy       string `json:"deploy_to"`
+		Created      int64  `json:"created"`
+		Started      int64  `json:"started"`
+		Finished     int64  `json:"finished"`
+	}
+
+	webhookSystem struct {
+		Link string `json:"link"`
+	}
+
+	// webhookHandler sends the notification for the finished builds of the
+	// webhook requests
+	webhookHandler struct {
+		plugin Plugin
+		secret string
+
+		// mu serializes the notifications, as sending uses global state
+		// like the tracer provider
+		mu sync.Mutex
+	}
+)
+
+// finishedStatuses are the build statuses of finished builds
+var finishedStatuses = map[string]bool{
+	"success": true,
+	"failure": true,
+	"error":   true,
+	"killed":  true,
+}
+
+// NewWebhookHandler returns a handler receiving Drone or Harness CI webhooks,
+// sending the notification configured in the plugin for every finished build.
+// Requests are verified with the HTTP signature of the secret unless empty.
+func NewWebhookHandler(p Plugin, secret string) http.Handler {
+	return &webhookHandler{
+		plugin: p,
+		secret: secret,
+	}
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 10<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.secret != "" {
+		if err := verifySignature(r, body, h.secret); err != nil {
+			log.Warnf("Rejected webhook: %v", err)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var req webhookRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid payload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if req.Event != "build" || !finishedStatuses[req.Build.Status] {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	log.Infof("Received build %s#%d with status %s", req.Repo.Slug, req.Build.Number, req.Build.Status)
+
+	h.mu.Lock()
+	err = h.plugin.withWebhook(req).Exec()
+	h.mu.Unlock()
+	if err != nil {
+		log.Errorf("Could not send notification for %s#%d: %v", req.Repo.Slug, req.Build.Number, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// withWebhook returns the plugin with the build information of the webhook
+func (p Plugin) withWebhook(req webhookRequest) Plugin {
+	p.Repo = Repo{
+		FullName: req.Repo.Slug,
+		Owner:    req.Repo.Namespace,
+		Name:     req.Repo.Name,
+		SCM:      req.Repo.SCM,
+		Link:     req.Repo.Link,
+		Branch:   req.Repo.DefaultBranch,
+		Private:  req.Repo.Private,
+		Trusted:  req.Repo.Trusted,
+	}
+	p.Remote = Remote{URL: req.Repo.HTTPURL}
+	p.Commit = Commit{
+		Sha:     req.Build.After,
+		Before:  req.Build.Before,
+		Ref:     req.Build.Ref,
+		Branch:  req.Build.Target,
+		Link:    req.Build.Link,
+		Message: req.Build.Message,
+		Author: Author{
+			Name:   req.Build.AuthorName,
+			Email:  req.Build.AuthorEmail,
+			Avatar: req.Build.AuthorAvatar,
+		},
+	}
+	p.Build = Build{
+		Number:   req.Build.Number,
+		Event:    req.Build.Event,
+		Status:   req.Build.Status,
+		Created:  float64(req.Build.Created),
+		Started:  float64(req.Build.Started),
+		Finished: float64(req.Build.Finished),
+	}
+	if req.System.Link != "" {
+		p.Build.Link = fmt.Sprintf("%s/%s/%d", strings.TrimRight(req.System.Link, "/"), req.Repo.Slug, req.Build.Number)
+	}
+	p.Prev = Prev{}
+	p.Job = Job{
+		Status:   req.Build.Status,
+		Started:  float64(req.Build.Started),
+		Finished: float64(req.Build.Finished),
+	}
+	p.Tag = strings.TrimPrefix(req.Build.Ref, "refs/tags/")
+	if p.Tag == req.Build.Ref {
+		p.Tag = ""
+	}
+	p.PullRequest = 0
+	if number, ok := strings.CutPrefix(req.Build.Ref, "refs/pull/"); ok {
+		number, _, _ = strings.Cut(number, "/")
+		p.PullRequest, _ = strconv.Atoi(number)
+	}
+	p.DeployTo = req.Build.Deploy
+	return p
+}
+
+// verifySignature verifies the HMAC-SHA256 HTTP signature Drone signs the
+// webhooks with, and the digest of the body
+func verifySignature(r *http.Request, body []byte, secret string) error {
+	header := r.Header.Get("Signature")
+	if header == "" {
+		header, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Signature ")
+	}
+	if header == "" {
+		return errors.New("missing signature")
+	}
+
+	params := map[string]string{}
+	for _, param := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		params[key] = strings.Trim(value, `"`)
+	}
+	if algorithm := params["algorithm"]; algorithm != "hmac-sha256" {
+		return fmt.Errorf("unsupported signature algorithm %q", algorithm)
+	}
+	signature, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+
+	headers := strings.Fields(strings.ToLower(params["headers"]))
+	if !slices.Contains(headers, "digest") {
+		return errors.New("signature does not cover the digest")
+	}
+	lines := make([]string, 0, len(headers))
+	for _, name := range headers {
+		if name == "(request-target)" {
+			lines = append(lines, fmt.Sprintf("%s: %s %s", name, strings.ToLower(r.Method), r.URL.RequestURI()))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", name, r.Header.Get(name)))
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return errors.New("signature mismatch")
+	}
+
+	// The signature covers the digest, the digest covers the body
+	sum := sha256.Sum256(body)
+	if r.Header.Get("Digest") != "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]) {
+		return errors.New("digest mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package emailer
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerifySignature(t *testing.T) {
+	const (
+		secret = "correct-horse-battery-staple"
+		body   = `{"event":"build","action":"updated"}`
+		digest = "SHA-256=ozf1tQoYclAqeCIyZOXItiFQE5H4tnDnaSrsTI0cmK8="
+	)
+
+	tests := []struct {
+		name          string
+		signature     string
+		authorization string
+		digest        string
+		wantErr       string
+	}{
+		{
+			name:      "valid",
+			signature: `keyId="hmac-key",algorithm="hmac-sha256",headers="(request-target) digest",signature="2VqnIiUYv243dXH2T3Q0qu8+HXHLvXuB3HEEPbIKtvM="`,
+			digest:    digest,
+		},
+		{
+			name:          "authorization header",
+			authorization: `Signature keyId="hmac-key",algorithm="hmac-sha256",headers="(request-target) digest",signature="2VqnIiUYv243dXH2T3Q0qu8+HXHLvXuB3HEEPbIKtvM="`,
+			digest:        digest,
+		},
+		{
+			name:    "missing",
+			digest:  digest,
+			wantErr: "missing signature",
+		},
+		{
+			name:      "unsupported algorithm",
+			signature: `keyId="rsa-key",algorithm="rsa-sha256",headers="(request-target) digest",signature="2VqnIiUYv243dXH2T3Q0qu8+HXHLvXuB3HEEPbIKtvM="`,
+			digest:    digest,
+			wantErr:   "unsupported signature algorithm",
+		},
+		{
+			name:      "digest not covered",
+			signature: `keyId="hmac-key",algorithm="hmac-sha256",headers="(request-target)",signature="2VqnIiUYv243dXH2T3Q0qu8+HXHLvXuB3HEEPbIKtvM="`,
+			digest:    digest,
+			wantErr:   "signature does not cover the digest",
+		},
+		{
+			name:      "wrong secret",
+			signature: `keyId="hmac-key",algorithm="hmac-sha256",headers="(request-target) digest",signature="CjGR4/kKsqCMT+RFjFI18Cs6mWxLkk3q7PaMEciKdyc="`,
+			digest:    digest,
+			wantErr:   "signature mismatch",
+		},
+		{
+			name:      "tampered body",
+			signature: `keyId="hmac-key",algorithm="hmac-sha256",headers="(request-target) digest",signature="TD4RhggqXZb3NwfQCP5fDf2FAE6B8pgvT8KDOAAWScU="`,
+			digest:    "SHA-256=AAAA",
+			wantErr:   "digest mismatch",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/hook", strings.NewReader(body))
+			r.Header.Set("Digest", test.digest)
+			if test.signature != "" {
+				r.Header.Set("Signature", test.signature)
+			}
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+
+			err := verifySignature(r, []byte(body), secret)
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Errorf("verifySignature() error = %v", err)
+			case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+				t.Errorf("verifySignature() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
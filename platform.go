@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// platform maps the environment variables of a CI platform to the Drone
+// environment variables the plugin reads
+type platform struct {
+	name string
+
+	// detect reports whether the plugin runs on the platform
+	detect func() bool
+
+	// env maps the Drone variables to the platform variables, the first set
+	// platform variable is used
+	env map[string][]string
+
+	// convert computes the Drone variables from platform variables in another
+	// format, an empty value is not set
+	convert map[string]func() string
+}
+
+// platforms are the supported CI platforms besides Drone
+var platforms = []platform{
+	{
+		name: "harness",
+		detect: func() bool {
+			return hasEnv("HARNESS_BUILD_ID", "HARNESS_ACCOUNT_ID")
+		},
+		env: map[string][]string{
+			"DRONE_REPO":                 {"CI_REPO"},
+			"DRONE_REPO_NAME":            {"CI_REPO_NAME"},
+			"DRONE_REPO_LINK":            {"CI_REPO_LINK"},
+			"DRONE_REPO_PRIVATE":         {"CI_REPO_PRIVATE"},
+			"DRONE_REMOTE_URL":           {"CI_REMOTE_URL", "CI_REPO_REMOTE"},
+			"DRONE_COMMIT_SHA":           {"CI_COMMIT_SHA"},
+			"DRONE_COMMIT_REF":           {"CI_COMMIT_REF"},
+			"DRONE_COMMIT_BRANCH":        {"CI_COMMIT_BRANCH"},
+			"DRONE_COMMIT_LINK":          {"CI_COMMIT_LINK"},
+			"DRONE_COMMIT_MESSAGE":       {"CI_COMMIT_MESSAGE"},
+			"DRONE_COMMIT_AUTHOR":        {"CI_COMMIT_AUTHOR", "CI_COMMIT_AUTHOR_NAME"},
+			"DRONE_COMMIT_AUTHOR_EMAIL":  {"CI_COMMIT_AUTHOR_EMAIL"},
+			"DRONE_COMMIT_AUTHOR_AVATAR": {"CI_COMMIT_AUTHOR_AVATAR"},
+			"DRONE_BUILD_NUMBER":         {"CI_BUILD_NUMBER", "HARNESS_BUILD_ID"},
+			"DRONE_BUILD_EVENT":          {"CI_BUILD_EVENT"},
+			"DRONE_BUILD_STATUS":         {"CI_BUILD_STATUS"},
+			"DRONE_BUILD_LINK":           {"CI_BUILD_LINK"},
+			"DRONE_BUILD_CREATED":        {"CI_BUILD_CREATED"},
+			"DRONE_BUILD_STARTED":        {"CI_BUILD_STARTED"},
+			"DRONE_BUILD_FINISHED":       {"CI_BUILD_FINISHED"},
+			"DRONE_PREV_BUILD_STATUS":    {"CI_PREV_BUILD_STATUS"},
+			"DRONE_PREV_BUILD_NUMBER":    {"CI_PREV_BUILD_NUMBER"},
+			"DRONE_PREV_COMMIT_SHA":      {"CI_PREV_COMMIT_SHA"},
+			"DRONE_JOB_NUMBER":           {"CI_JOB_NUMBER"},
+			"DRONE_JOB_STATUS":           {"CI_JOB_STATUS"},
+			"DRONE_JOB_STARTED":          {"CI_JOB_STARTED"},
+			"DRONE_JOB_FINISHED":         {"CI_JOB_FINISHED"},
+			"DRONE_TAG":                  {"CI_TAG"},
+		},
+	},
+	{
+		name: "woodpecker",
+		detect: func() bool {
+			return os.Getenv("CI") == "woodpecker"
+		},
+		env: map[string][]string{
+			"DRONE_REPO":                 {"CI_REPO"},
+			"DRONE_REPO_OWNER":           {"CI_REPO_OWNER"},
+			"DRONE_REPO_NAME":            {"CI_REPO_NAME"},
+			"DRONE_REPO_SCM":             {"CI_REPO_SCM"},
+			"DRONE_REPO_LINK":            {"CI_REPO_URL", "CI_REPO_LINK"},
+			"DRONE_REPO_BRANCH":          {"CI_REPO_DEFAULT_BRANCH"},
+			"DRONE_REPO_PRIVATE":         {"CI_REPO_PRIVATE"},
+			"DRONE_REPO_TRUSTED":         {"CI_REPO_TRUSTED"},
+			"DRONE_REMOTE_URL":           {"CI_REPO_CLONE_URL", "CI_REPO_REMOTE"},
+			"DRONE_COMMIT_SHA":           {"CI_COMMIT_SHA"},
+			"DRONE_COMMIT_BEFORE":        {"CI_PREV_COMMIT_SHA"},
+			"DRONE_COMMIT_REF":           {"CI_COMMIT_REF"},
+			"DRONE_COMMIT_BRANCH":        {"CI_COMMIT_BRANCH"},
+			"DRONE_COMMIT_LINK":          {"CI_COMMIT_URL", "CI_COMMIT_LINK"},
+			"DRONE_COMMIT_MESSAGE":       {"CI_COMMIT_MESSAGE"},
+			"DRONE_COMMIT_AUTHOR":        {"CI_COMMIT_AUTHOR"},
+			"DRONE_COMMIT_AUTHOR_EMAIL":  {"CI_COMMIT_AUTHOR_EMAIL"},
+			"DRONE_COMMIT_AUTHOR_AVATAR": {"CI_COMMIT_AUTHOR_AVATAR"},
+			"DRONE_BUILD_NUMBER":         {"CI_PIPELINE_NUMBER", "CI_BUILD_NUMBER"},
+			"DRONE_BUILD_EVENT":          {"CI_PIPELINE_EVENT", "CI_BUILD_EVENT"},
+			"DRONE_BUILD_STATUS":         {"CI_PIPELINE_STATUS", "CI_BUILD_STATUS"},
+			"DRONE_BUILD_LINK":           {"CI_PIPELINE_URL", "CI_PIPELINE_LINK", "CI_BUILD_LINK"},
+			"DRONE_BUILD_CREATED":        {"CI_PIPELINE_CREATED", "CI_BUILD_CREATED"},
+			"DRONE_BUILD_STARTED":        {"CI_PIPELINE_STARTED", "CI_BUILD_STARTED"},
+			"DRONE_BUILD_FINISHED":       {"CI_PIPELINE_FINISHED", "CI_BUILD_FINISHED"},
+			"DRONE_PREV_BUILD_STATUS":    {"CI_PREV_PIPELINE_STATUS", "CI_PREV_BUILD_STATUS"},
+			"DRONE_PREV_BUILD_NUMBER":    {"CI_PREV_PIPELINE_NUMBER", "CI_PREV_BUILD_NUMBER"},
+			"DRONE_PREV_COMMIT_SHA":      {"CI_PREV_COMMIT_SHA"},
+			"DRONE_JOB_NUMBER":           {"CI_STEP_NUMBER", "CI_JOB_NUMBER"},
+			"DRONE_JOB_STATUS":           {"CI_STEP_STATUS", "CI_JOB_STATUS"},
+			"DRONE_JOB_STARTED":          {"CI_STEP_STARTED", "CI_JOB_STARTED"},
+			"DRONE_JOB_FINISHED":         {"CI_STEP_FINISHED", "CI_JOB_FINISHED"},
+			"DRONE_TAG":                  {"CI_COMMIT_TAG"},
+			"DRONE_PULL_REQUEST":         {"CI_COMMIT_PULL_REQUEST"},
+			"DRONE_DEPLOY_TO":            {"CI_PIPELINE_DEPLOY_TARGET", "CI_BUILD_DEPLOY_TARGET"},
+		},
+	},
+	{
+		name: "gitlab",
+		detect: func() bool {
+			return os.Getenv("GITLAB_CI") == "true"
+		},
+		env: map[string][]string{
+			"DRONE_REPO":           {"CI_PROJECT_PATH"},
+			"DRONE_REPO_OWNER":     {"CI_PROJECT_NAMESPACE"},
+			"DRONE_REPO_NAME":      {"CI_PROJECT_NAME"},
+			"DRONE_REPO_LINK":      {"CI_PROJECT_URL"},
+			"DRONE_REPO_BRANCH":    {"CI_DEFAULT_BRANCH"},
+			"DRONE_COMMIT_SHA":     {"CI_COMMIT_SHA"},
+			"DRONE_COMMIT_BEFORE":  {"CI_COMMIT_BEFORE_SHA"},
+			"DRONE_COMMIT_BRANCH":  {"CI_COMMIT_BRANCH", "CI_MERGE_REQUEST_TARGET_BRANCH_NAME", "CI_COMMIT_REF_NAME"},
+			"DRONE_COMMIT_MESSAGE": {"CI_COMMIT_MESSAGE"},
+			"DRONE_BUILD_NUMBER":   {"CI_PIPELINE_IID", "CI_PIPELINE_ID"},
+			"DRONE_BUILD_LINK":     {"CI_PIPELINE_URL"},
+			"DRONE_JOB_NUMBER":     {"CI_JOB_ID"},
+			"DRONE_TAG":            {"CI_COMMIT_TAG"},
+			"DRONE_PULL_REQUEST":   {"CI_MERGE_REQUEST_IID"},
+			"DRONE_DEPLOY_TO":      {"CI_ENVIRONMENT_NAME"},
+		},
+		convert: map[string]func() string{
+			"DRONE_REPO_PRIVATE": func() string {
+				if visibility := os.Getenv("CI_PROJECT_VISIBILITY"); visibility != "" {
+					return strconv.FormatBool(visibility != "public")
+				}
+				return ""
+			},
+			"DRONE_COMMIT_REF": func() string {
+				if tag := os.Getenv("CI_COMMIT_TAG"); tag != "" {
+					return "refs/tags/" + tag
+				}
+				if iid := os.Getenv("CI_MERGE_REQUEST_IID"); iid != "" {
+					return "refs/merge-requests/" + iid + "/head"
+				}
+				if branch := os.Getenv("CI_COMMIT_BRANCH"); branch != "" {
+					return "refs/heads/" + branch
+				}
+				return ""
+			},
+			"DRONE_COMMIT_LINK": func() string {
+				if url, sha := os.Getenv("CI_PROJECT_URL"), os.Getenv("CI_COMMIT_SHA"); url != "" && sha != "" {
+					return url + "/-/commit/" + sha
+				}
+				return ""
+			},
+			"DRONE_COMMIT_AUTHOR": func() string {
+				if author, err := mail.ParseAddress(os.Getenv("CI_COMMIT_AUTHOR")); err == nil {
+					return author.Name
+				}
+				return ""
+			},
+			"DRONE_COMMIT_AUTHOR_EMAIL": func() string {
+				if author, err := mail.ParseAddress(os.Getenv("CI_COMMIT_AUTHOR")); err == nil {
+					return author.Address
+				}
+				return ""
+			},
+			"DRONE_BUILD_EVENT": func() string {
+				switch source := os.Getenv("CI_PIPELINE_SOURCE"); source {
+				case "push":
+					if os.Getenv("CI_COMMIT_TAG") != "" {
+						return "tag"
+					}
+					return "push"
+				case "merge_request_event", "external_pull_request_event":
+					return "pull_request"
+				case "schedule":
+					return "cron"
+				case "":
+					return ""
+				default:
+					return "custom"
+				}
+			},
+			"DRONE_BUILD_STATUS":  func() string { return gitlabStatus(os.Getenv("CI_JOB_STATUS")) },
+			"DRONE_JOB_STATUS":    func() string { return gitlabStatus(os.Getenv("CI_JOB_STATUS")) },
+			"DRONE_BUILD_CREATED": func() string { return unixTime(os.Getenv("CI_PIPELINE_CREATED_AT")) },
+			"DRONE_BUILD_STARTED": func() string { return unixTime(os.Getenv("CI_PIPELINE_CREATED_AT")) },
+			"DRONE_JOB_STARTED":   func() string { return unixTime(os.Getenv("CI_JOB_STARTED_AT")) },
+		},
+	},
+}
+
+// gitlabStatus converts the GitLab job status to the Drone build status
+func gitlabStatus(status string) string {
+	switch status {
+	case "failed":
+		return "failure"
+	case "canceled":
+		return "killed"
+	default:
+		return status
+	}
+}
+
+// unixTime converts the RFC 3339 time to a Unix timestamp
+func unixTime(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// loadPlatformEnv sets the Drone environment variables from the variables of
+// the CI platform, detected unless given by name. Variables already set take
+// precedence.
+func loadPlatformEnv(selected string) error {
+	if selected == "drone" {
+		return nil
+	}
+
+	for _, p := range platforms {
+		if selected != "" && p.name != selected || selected == "" && !p.detect() {
+			continue
+		}
+
+		for name, sources := range p.env {
+			if _, ok := os.LookupEnv(name); ok {
+				continue
+			}
+			for _, source := range sources {
+				if value, ok := os.LookupEnv(source); ok {
+					os.Setenv(name, value)
+					break
+				}
+			}
+		}
+		for name, convert := range p.convert {
+			if _, ok := os.LookupEnv(name); ok {
+				continue
+			}
+			if value := convert(); value != "" {
+				os.Setenv(name, value)
+			}
+		}
+
+		// The owner and name are part of the full repository name
+		if owner, name, ok := strings.Cut(os.Getenv("DRONE_REPO"), "/"); ok {
+			if !hasEnv("DRONE_REPO_OWNER") {
+				os.Setenv("DRONE_REPO_OWNER", owner)
+			}
+			if !hasEnv("DRONE_REPO_NAME") {
+				os.Setenv("DRONE_REPO_NAME", name)
+			}
+		}
+		return nil
+	}
+
+	if selected != "" {
+		return fmt.Errorf("unknown platform %q", selected)
+	}
+	return nil
+}
+
+// hasEnv reports whether any of the environment variables is set
+func hasEnv(names ...string) bool {
+	for _, name := range names {
+		if _, ok := os.LookupEnv(name); ok {
+			return true
+		}
+	}
+	return false
+}